@@ -0,0 +1,149 @@
+package kalman
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// ExtendedKalmanFilter is responsible for prediction and filtering
+// of a given nonlinear model. The state is propagated through the nonlinear
+// dynamics of the model, whilst the covariance is propagated using the
+// Jacobian of the dynamics evaluated at the current state estimate.
+type ExtendedKalmanFilter struct {
+	model        models.NonlinearModel
+	updateConfig UpdateConfig
+
+	dims       int
+	t          time.Time
+	state      *mat.VecDense
+	covariance *mat.Dense
+
+	logLikelihood float64
+}
+
+// NewExtendedKalmanFilter returns a new ExtendedKalmanFilter for the given nonlinear model.
+func NewExtendedKalmanFilter(model models.NonlinearModel) *ExtendedKalmanFilter {
+	initial := model.InitialState()
+
+	return &ExtendedKalmanFilter{
+		model:      model,
+		dims:       initial.State.Len(),
+		t:          initial.Time,
+		state:      mat.VecDenseCopyOf(initial.State),
+		covariance: mat.DenseCopyOf(initial.Covariance),
+	}
+}
+
+// State returns the current hidden state of the ExtendedKalmanFilter.
+func (kf *ExtendedKalmanFilter) State() mat.Vector {
+	return kf.state
+}
+
+// Covariance returns the current covariance of the model.
+func (kf *ExtendedKalmanFilter) Covariance() mat.Matrix {
+	return kf.covariance
+}
+
+// SetCovariance resets the covariance of the filter to the given value.
+func (kf *ExtendedKalmanFilter) SetCovariance(covariance mat.Matrix) {
+	kf.covariance = mat.DenseCopyOf(covariance)
+}
+
+// SetState resets the state of the filter to the given value.
+func (kf *ExtendedKalmanFilter) SetState(state mat.Vector) {
+	kf.state = mat.VecDenseCopyOf(state)
+}
+
+// SetUpdateConfig selects how measurements are fused into the state and covariance.
+func (kf *ExtendedKalmanFilter) SetUpdateConfig(cfg UpdateConfig) {
+	kf.updateConfig = cfg
+}
+
+// LogLikelihood returns the accumulated log-likelihood of all measurements fused
+// by the filter, given the predictions of the model.
+// The contribution of each measurement is provided by UpdateWithResult.
+// Measurements rejected by a gate do not contribute.
+func (kf *ExtendedKalmanFilter) LogLikelihood() float64 {
+	return kf.logLikelihood
+}
+
+// Time returns the time for which the current hidden state is an estimate.
+// The time is monotone increasing.
+func (kf *ExtendedKalmanFilter) Time() time.Time {
+	return kf.t
+}
+
+// Predict advances the filter from the internal current time to the given time
+// using the nonlinear model.
+// Each time can be no earlier than the current time of the filter.
+func (kf *ExtendedKalmanFilter) Predict(t time.Time) error {
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.Equal(kf.t) {
+		return nil
+	}
+
+	dt := t.Sub(kf.t)
+	kf.t = t
+
+	// The Jacobian must be evaluated at the state before it is propagated.
+	F := kf.model.PropagationJacobian(kf.state, dt)
+	Q := kf.model.CovarianceTransition(dt)
+	P := kf.covariance
+
+	kf.state = mat.VecDenseCopyOf(kf.model.Propagate(kf.state, dt))
+
+	newCovariance := mat.NewDense(kf.dims, kf.dims, nil)
+	newCovariance.Product(F, P, F.T())
+	newCovariance.Add(newCovariance, Q)
+	kf.covariance = newCovariance
+
+	return nil
+}
+
+// Update is used to take a new measurement from a sensor and fuse it to the model.
+// Both linear and nonlinear measurements may be fused, nonlinear measurements
+// are linearized about the current state estimate.
+// An error is returned if the innovation covariance of the measurement is singular,
+// in which case the measurement is not fused.
+// The time field must be no earlier than the current time of the filter.
+func (kf *ExtendedKalmanFilter) Update(t time.Time, m *models.Measurement) error {
+	_, err := kf.UpdateWithResult(t, m)
+	return err
+}
+
+// UpdateWithResult is identical to Update, but also returns the intermediate
+// quantities computed whilst fusing the measurement, such as the innovation
+// and the Kalman gain.
+func (kf *ExtendedKalmanFilter) UpdateWithResult(t time.Time, m *models.Measurement) (*UpdateResult, error) {
+	if t.Before(kf.t) {
+		return nil, fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.After(kf.t) {
+		err := kf.Predict(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := measurementUpdate(kf.state, kf.covariance, m, kf.updateConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	kf.state = p.state
+	kf.covariance = p.covariance
+	kf.t = t
+
+	if !p.result.Rejected {
+		kf.logLikelihood += p.result.LogLikelihood
+	}
+
+	return p.result, nil
+}
@@ -0,0 +1,416 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// EMConfig controls expectation-maximization estimation.
+type EMConfig struct {
+	// MaxIterations defaults to 100 if zero.
+	MaxIterations int
+	// Tolerance is the change in log-likelihood, relative to its magnitude, below which
+	// the estimation is considered to have converged. Defaults to 1e-6 if zero.
+	Tolerance float64
+
+	// Quantities that are fixed are not re-estimated.
+	FixInitialState     bool
+	FixProcessNoise     bool
+	FixObservationNoise bool
+
+	// EstimateInitialCovariance re-estimates the covariance of the initial state, as well as its mean.
+	// By default only the mean is re-estimated, since from a single sequence of measurements
+	// the estimated covariance shrinks towards zero with every iteration.
+	EstimateInitialCovariance bool
+}
+
+// EMResult holds the estimates found by expectation-maximization.
+//
+// Since the time steps between measurements need not be uniform, the process noise is
+// estimated relative to the CovarianceTransition of the model. For the Cholesky factorization
+// C_k C_k^T of the CovarianceTransition of step k, the estimated process noise of the step is
+// C_k ProcessNoise C_k^T. The observation noise is estimated relative to the covariance
+// of each measurement in the same way. An identity matrix leaves the noise unchanged.
+// When the process noise of the model is the same for every step, as for uniform time steps,
+// and every measurement has the same covariance, these give the maximum-likelihood estimates
+// of the full process and observation noise covariances.
+// Model and Measurements apply the estimates to a model and to measurements.
+type EMResult struct {
+	InitialState models.State
+
+	ProcessNoise     mat.Matrix
+	ObservationNoise mat.Matrix
+
+	LogLikelihood float64
+	Iterations    int
+	Converged     bool
+}
+
+// Model returns the given model with its initial state and process noise replaced by the estimates.
+func (r *EMResult) Model(model models.LinearModel) models.LinearModel {
+	return &estimatedModel{
+		LinearModel:  model,
+		initialState: r.InitialState,
+		processNoise: r.ProcessNoise,
+	}
+}
+
+// Measurements returns copies of the given measurements with the estimated observation noise.
+// An error is returned if a measurement has a different dimension to the ObservationNoise.
+func (r *EMResult) Measurements(measurements []*MeasurementAtTime) ([]*MeasurementAtTime, error) {
+	return withObservationNoise(measurements, r.ObservationNoise)
+}
+
+// ExpectationMaximization estimates the mean of the initial state of the model, along with
+// its process noise and the noise of the measurements, from the given batch of measurements.
+// Each iteration smooths the measurements under the current estimates (the E step), and then
+// re-estimates the parameters in closed form from the smoothed moments (the M step).
+// The CovarianceTransition of the model must be invertible for every non-zero time step, and
+// all measurements must have the same dimension unless the observation noise is fixed.
+func (kf *KalmanSmoother) ExpectationMaximization(cfg EMConfig, measurements ...*MeasurementAtTime) (*EMResult, error) {
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("no measurements to estimate from")
+	}
+
+	maxIterations := cfg.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = 100
+	}
+
+	tolerance := cfg.Tolerance
+	if tolerance == 0 {
+		tolerance = 1e-6
+	}
+
+	initial := kf.model.InitialState()
+	dims := initial.State.Len()
+	measurementDims := measurements[0].Value.Len()
+
+	if !cfg.FixObservationNoise {
+		for i, m := range measurements {
+			if m.Value.Len() != measurementDims {
+				return nil, fmt.Errorf(
+					"measurement at index %d has dimension %d (expected %d), observation noise can only be estimated for measurements of the same dimension",
+					i, m.Value.Len(), measurementDims,
+				)
+			}
+		}
+	}
+
+	result := &EMResult{
+		InitialState: models.State{
+			Time:       initial.Time,
+			State:      mat.VecDenseCopyOf(initial.State),
+			Covariance: mat.DenseCopyOf(initial.Covariance),
+		},
+		ProcessNoise:     eye(dims),
+		ObservationNoise: eye(measurementDims),
+	}
+
+	previous := math.Inf(-1)
+
+	for iteration := 0; ; iteration++ {
+		smoother := NewKalmanSmoother(result.Model(kf.model))
+		smoother.SetUpdateConfig(kf.updateConfig)
+
+		ms := measurements
+		if !cfg.FixObservationNoise {
+			var err error
+			ms, err = result.Measurements(measurements)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ss, err := smoother.computeForwardsStateChanges(ms...)
+		if err != nil {
+			return nil, err
+		}
+
+		logLikelihood := 0.0
+		for _, s := range ss {
+			logLikelihood += s.logLikelihood
+		}
+
+		result.LogLikelihood = logLikelihood
+		result.Iterations = iteration
+
+		if math.Abs(logLikelihood-previous) <= tolerance*math.Max(1, math.Abs(logLikelihood)) {
+			result.Converged = true
+			break
+		}
+
+		if iteration == maxIterations {
+			break
+		}
+
+		previous = logLikelihood
+
+		smoothed, err := smoothBackwards(ss)
+		if err != nil {
+			return nil, err
+		}
+
+		initialSmoothed, initialCrossCovariance, err := smoothInitialState(result.InitialState, ss[0], smoothed.states[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if !cfg.FixProcessNoise {
+			processNoise, err := kf.estimateProcessNoise(measurements, ss, smoothed, initialSmoothed, initialCrossCovariance)
+			if err != nil {
+				return nil, err
+			}
+			result.ProcessNoise = processNoise
+		}
+
+		if !cfg.FixObservationNoise {
+			observationNoise, err := estimateObservationNoise(measurements, smoothed.states)
+			if err != nil {
+				return nil, err
+			}
+			result.ObservationNoise = observationNoise
+		}
+
+		if !cfg.FixInitialState {
+			result.InitialState.State = initialSmoothed.State
+			if cfg.EstimateInitialCovariance {
+				result.InitialState.Covariance = initialSmoothed.Covariance
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// smoothInitialState extends the backwards pass of the smoother to the initial state of the model,
+// returning the smoothed initial state along with the cross covariance of the first smoothed
+// state and the smoothed initial state.
+func smoothInitialState(initial models.State, first kalmanStateChange, firstSmoothed models.State) (models.State, mat.Matrix, error) {
+	dims := initial.State.Len()
+
+	aPrioriCovarianceInv := mat.NewDense(dims, dims, nil)
+	err := aPrioriCovarianceInv.Inverse(first.aPrioriCovariance)
+	if err != nil {
+		return models.State{}, nil, fmt.Errorf("a priori covariance is singular: %s", err)
+	}
+
+	C := mat.NewDense(dims, dims, nil)
+	C.Product(initial.Covariance, first.modelTransition.T(), aPrioriCovarianceInv)
+
+	x := mat.NewVecDense(dims, nil)
+	x.SubVec(firstSmoothed.State, first.aPrioriState)
+	x.MulVec(C, x)
+	x.AddVec(initial.State, x)
+
+	P := mat.NewDense(dims, dims, nil)
+	P.Sub(firstSmoothed.Covariance, first.aPrioriCovariance)
+	P.Product(C, P, C.T())
+	P.Add(initial.Covariance, P)
+
+	crossCovariance := mat.NewDense(dims, dims, nil)
+	crossCovariance.Mul(firstSmoothed.Covariance, C.T())
+
+	return models.State{
+		Time:       initial.Time,
+		State:      x,
+		Covariance: P,
+	}, crossCovariance, nil
+}
+
+// estimateProcessNoise computes the process noise W maximizing the expected log-likelihood
+// of the state transitions, where the process noise of each step is C_k W C_k^T
+// for the Cholesky factor C_k of the process noise Q_k of the model:
+// W = 1/N sum_k C_k^-1 E[w_k w_k^T] C_k^-T, for the process noise w_k = x_k - F_k x_{k-1}.
+func (kf *KalmanSmoother) estimateProcessNoise(
+	measurements []*MeasurementAtTime,
+	ss []kalmanStateChange,
+	smoothed *backwardsPass,
+	initial models.State,
+	initialCrossCovariance mat.Matrix,
+) (mat.Matrix, error) {
+	dims := initial.State.Len()
+
+	previousTime := initial.Time
+	previous := initial
+	var crossCovariance mat.Matrix = initialCrossCovariance
+
+	total := mat.NewDense(dims, dims, nil)
+	count := 0
+
+	for i, m := range measurements {
+		current := smoothed.states[i]
+		dt := m.Time.Sub(previousTime)
+
+		if dt > 0 {
+			F := ss[i].modelTransition
+
+			// E[w w^T] = d d^T + P_k - F P_{k,k-1}^T - P_{k,k-1} F^T + F P_{k-1} F^T,
+			// for the smoothed residual d = x_k - F x_{k-1}.
+			d := mat.NewVecDense(dims, nil)
+			d.MulVec(F, previous.State)
+			d.SubVec(current.State, d)
+
+			E := mat.NewDense(dims, dims, nil)
+			E.Outer(1, d, d)
+			E.Add(E, current.Covariance)
+
+			FC := mat.NewDense(dims, dims, nil)
+			FC.Mul(F, crossCovariance.T())
+			E.Sub(E, FC)
+			E.Sub(E, FC.T())
+
+			FPF := mat.NewDense(dims, dims, nil)
+			FPF.Product(F, previous.Covariance, F.T())
+			E.Add(E, FPF)
+
+			whitened, err := whiten(kf.model.CovarianceTransition(dt), E)
+			if err != nil {
+				return nil, fmt.Errorf("process noise for time step %s: %s", dt, err)
+			}
+
+			total.Add(total, whitened)
+			count++
+		}
+
+		previousTime = m.Time
+		previous = current
+		if i < len(smoothed.crossCovariances) {
+			crossCovariance = smoothed.crossCovariances[i]
+		}
+	}
+
+	if count == 0 {
+		return nil, fmt.Errorf("no time steps to estimate process noise from")
+	}
+
+	total.Scale(1/float64(count), total)
+	return symmetrize(total), nil
+}
+
+// estimateObservationNoise computes the observation noise V maximizing the expected log-likelihood
+// of the measurements, where the covariance of each measurement is D_k V D_k^T for the Cholesky
+// factor D_k of its covariance R_k:
+// V = 1/M sum_k D_k^-1 E[v_k v_k^T] D_k^-T, for the measurement noise v_k = z_k - h(x_k).
+func estimateObservationNoise(measurements []*MeasurementAtTime, smoothed []models.State) (mat.Matrix, error) {
+	n := measurements[0].Value.Len()
+	total := mat.NewDense(n, n, nil)
+
+	for i, m := range measurements {
+		x := smoothed[i].State
+		H := m.Jacobian(x)
+
+		// E[v v^T] = e e^T + H P H^T for the smoothed residual e = z - h(x).
+		e := mat.NewVecDense(n, nil)
+		e.SubVec(m.Value, m.Observe(x))
+
+		E := mat.NewDense(n, n, nil)
+		E.Product(H, smoothed[i].Covariance, H.T())
+
+		outer := mat.NewDense(n, n, nil)
+		outer.Outer(1, e, e)
+		E.Add(E, outer)
+
+		whitened, err := whiten(m.Covariance, E)
+		if err != nil {
+			return nil, fmt.Errorf("covariance of measurement %d: %s", i, err)
+		}
+
+		total.Add(total, whitened)
+	}
+
+	total.Scale(1/float64(len(measurements)), total)
+	return symmetrize(total), nil
+}
+
+// whiten returns C^-1 E C^-T, for the Cholesky factorization C C^T of the covariance a.
+func whiten(a, E mat.Matrix) (*mat.Dense, error) {
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(a)); !ok {
+		return nil, fmt.Errorf("covariance is not positive definite")
+	}
+
+	n, _ := a.Dims()
+
+	var inverse mat.TriDense
+	err := inverse.InverseTri(chol.LTo(nil))
+	if err != nil {
+		return nil, fmt.Errorf("covariance is singular: %s", err)
+	}
+
+	result := mat.NewDense(n, n, nil)
+	result.Product(&inverse, E, inverse.T())
+
+	return result, nil
+}
+
+// colour returns C W C^T, for the Cholesky factorization C C^T of the covariance a.
+// This is the inverse of whiten.
+func colour(a, W mat.Matrix) (*mat.Dense, error) {
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(a)); !ok {
+		return nil, fmt.Errorf("covariance is not positive definite")
+	}
+
+	n, _ := a.Dims()
+	L := chol.LTo(nil)
+
+	result := mat.NewDense(n, n, nil)
+	result.Product(L, W, L.T())
+
+	return result, nil
+}
+
+// estimatedModel overrides the initial state of a model and its process noise.
+type estimatedModel struct {
+	models.LinearModel
+
+	initialState models.State
+	processNoise mat.Matrix
+}
+
+func (m *estimatedModel) InitialState() models.State {
+	return m.initialState
+}
+
+// CovarianceTransition returns C W C^T for the Cholesky factor C of the process noise of the model,
+// and the estimated process noise W. The process noise of the model is returned unchanged
+// if it can't be factorized, as is the case for a time step of zero.
+func (m *estimatedModel) CovarianceTransition(dt time.Duration) mat.Matrix {
+	Q := m.LinearModel.CovarianceTransition(dt)
+
+	result, err := colour(Q, m.processNoise)
+	if err != nil {
+		return Q
+	}
+
+	return result
+}
+
+// withObservationNoise returns copies of the measurements, with the covariance R of each
+// replaced by D V D^T for the Cholesky factorization D D^T of R.
+func withObservationNoise(measurements []*MeasurementAtTime, V mat.Matrix) ([]*MeasurementAtTime, error) {
+	result := make([]*MeasurementAtTime, len(measurements))
+	n, _ := V.Dims()
+
+	for i, m := range measurements {
+		if m.Value.Len() != n {
+			return nil, fmt.Errorf("measurement at index %d has dimension %d (expected %d)", i, m.Value.Len(), n)
+		}
+
+		covariance, err := colour(m.Covariance, V)
+		if err != nil {
+			return nil, fmt.Errorf("covariance of measurement %d: %s", i, err)
+		}
+
+		copied := *m
+		copied.Covariance = covariance
+		result[i] = &copied
+	}
+
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package kalman
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// simulateConstantVelocity simulates n position measurements, one per second, of a particle
+// whose acceleration is white noise with the given spectral density, observed with the given variance.
+func simulateConstantVelocity(n int, spectralDensity, observationVariance float64) []*MeasurementAtTime {
+	r := rand.New(rand.NewSource(1))
+
+	var t0 time.Time
+	position, velocity := 0.0, 1.0
+
+	// The exact discretization of white noise acceleration for a unit time step.
+	var chol mat.Cholesky
+	chol.Factorize(mat.NewSymDense(2, []float64{
+		spectralDensity / 3, spectralDensity / 2,
+		spectralDensity / 2, spectralDensity,
+	}))
+	L := chol.LTo(nil)
+
+	result := make([]*MeasurementAtTime, n)
+	for i := range result {
+		noise := mat.NewVecDense(2, []float64{r.NormFloat64(), r.NormFloat64()})
+		noise.MulVec(L, noise)
+
+		position += velocity + noise.AtVec(0)
+		velocity += noise.AtVec(1)
+
+		value := position + math.Sqrt(observationVariance)*r.NormFloat64()
+		result[i] = NewMeasurementAtTime(
+			t0.Add(time.Duration(i+1)*time.Second),
+			&models.Measurement{
+				Value:            mat.NewVecDense(1, []float64{value}),
+				Covariance:       mat.NewDense(1, 1, []float64{1}),
+				ObservationModel: mat.NewDense(1, 2, []float64{1, 0}),
+			},
+		)
+	}
+
+	return result
+}
+
+func newWhiteNoiseAccelerationModel() *models.ConstantVelocityModel {
+	return models.NewConstantVelocityModel(
+		time.Time{},
+		mat.NewVecDense(1, nil),
+		models.ConstantVelocityModelConfig{
+			InitialVariance: 1,
+			ProcessVariance: 1,
+			ProcessNoise:    models.WhiteNoiseAcceleration,
+		},
+	)
+}
+
+func TestExpectationMaximizationRecoversNoise(t *testing.T) {
+	model := newWhiteNoiseAccelerationModel()
+	measurements := simulateConstantVelocity(2000, 0.5, 2)
+
+	result, err := NewKalmanSmoother(model).ExpectationMaximization(EMConfig{}, measurements...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Converged {
+		t.Fatalf("expected convergence, stopped after %d iterations", result.Iterations)
+	}
+
+	expectedQ := []float64{0.5 / 3, 0.5 / 2, 0.5 / 2, 0.5}
+	Q := result.Model(model).CovarianceTransition(time.Second)
+	for i, expected := range expectedQ {
+		if actual := Q.At(i/2, i%2); math.Abs(actual-expected) > 0.1 {
+			t.Errorf("expected process noise %v, got %v", expectedQ, mat.Formatted(Q))
+			break
+		}
+	}
+
+	ms, err := result.Measurements(measurements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if R := ms[0].Covariance.At(0, 0); math.Abs(R-2) > 0.25*2 {
+		t.Errorf("expected observation variance 2, got %v", R)
+	}
+}
+
+func TestExpectationMaximizationConvergesWithDefaults(t *testing.T) {
+	model := newWhiteNoiseAccelerationModel()
+	measurements := simulateConstantVelocity(300, 0.5, 2)
+
+	result, err := NewKalmanSmoother(model).ExpectationMaximization(EMConfig{}, measurements...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Converged || result.Iterations >= 100 {
+		t.Fatalf("expected convergence, stopped after %d iterations", result.Iterations)
+	}
+
+	// Only the mean of the initial state is re-estimated by default.
+	initial := model.InitialState().Covariance
+	if !mat.EqualApprox(result.InitialState.Covariance, initial, 1e-12) {
+		t.Errorf("expected the initial covariance to be unchanged, got %v", mat.Formatted(result.InitialState.Covariance))
+	}
+	if mat.Equal(result.InitialState.State, model.InitialState().State) {
+		t.Errorf("expected the initial mean to be re-estimated")
+	}
+}
+
+func TestExpectationMaximizationFixedNoise(t *testing.T) {
+	model := newWhiteNoiseAccelerationModel()
+	measurements := simulateConstantVelocity(50, 0.5, 2)
+
+	cfg := EMConfig{FixProcessNoise: true, FixObservationNoise: true, MaxIterations: 5}
+	result, err := NewKalmanSmoother(model).ExpectationMaximization(cfg, measurements...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !mat.Equal(result.ProcessNoise, eye(2)) || !mat.Equal(result.ObservationNoise, eye(1)) {
+		t.Errorf("expected fixed noise to be unchanged")
+	}
+}
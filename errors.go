@@ -0,0 +1,58 @@
+package kalman
+
+import (
+	"fmt"
+	"time"
+)
+
+// SingularCovarianceError is returned by the smoother when the a priori covariance
+// of a step can't be inverted, as is required by the Rauch–Tung–Striebel backwards pass.
+type SingularCovarianceError struct {
+	// Index is the index of the step whose a priori covariance is singular,
+	// which for Smooth is the index of the measurement.
+	Index int
+	Err   error
+}
+
+func (e *SingularCovarianceError) Error() string {
+	return fmt.Sprintf("a priori covariance at index %d is singular: %s", e.Index, e.Err)
+}
+
+// UnsortedMeasurementError is returned by the smoother when a measurement is earlier than
+// the measurement before it, or than the initial state of the model.
+// SortMeasurements may be used to put a batch of measurements in order.
+type UnsortedMeasurementError struct {
+	// Index is the index of the out of order measurement.
+	Index    int
+	Time     time.Time
+	Previous time.Time
+}
+
+func (e *UnsortedMeasurementError) Error() string {
+	return fmt.Sprintf("measurement at index %d is out of order: %s is before %s", e.Index, e.Time, e.Previous)
+}
+
+// DimensionMismatchError is returned when the dimensions of a measurement
+// are inconsistent with each other, or with the state of the model.
+// A missing value or matrix is reported with a size of 0x0.
+type DimensionMismatchError struct {
+	// Index is the index of the measurement in the batch being smoothed,
+	// or -1 if the measurement was not part of a batch.
+	Index int
+	// Name describes the mismatched quantity, such as "covariance".
+	Name                       string
+	Rows, Cols                 int
+	ExpectedRows, ExpectedCols int
+}
+
+func (e *DimensionMismatchError) Error() string {
+	prefix := "measurement"
+	if e.Index >= 0 {
+		prefix = fmt.Sprintf("measurement at index %d", e.Index)
+	}
+
+	return fmt.Sprintf(
+		"%s has %s of size %dx%d (expected %dx%d)",
+		prefix, e.Name, e.Rows, e.Cols, e.ExpectedRows, e.ExpectedCols,
+	)
+}
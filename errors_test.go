@@ -0,0 +1,98 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestUnsortedMeasurementError(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 3)
+	ms[1], ms[2] = ms[2], ms[1]
+
+	_, err := NewKalmanSmoother(model).Smooth(ms...)
+
+	e, ok := err.(*UnsortedMeasurementError)
+	if !ok {
+		t.Fatalf("expected an UnsortedMeasurementError, got %v", err)
+	}
+
+	if e.Index != 2 || !e.Time.Equal(ms[2].Time) || !e.Previous.Equal(ms[1].Time) {
+		t.Errorf("unexpected error: %s", e)
+	}
+}
+
+func TestSingularCovarianceError(t *testing.T) {
+	// Without any uncertainty in the model, the a priori covariance is zero.
+	model := models.NewConstantVelocityModel(
+		time.Time{},
+		mat.NewVecDense(1, nil),
+		models.ConstantVelocityModelConfig{},
+	)
+
+	_, err := NewKalmanSmoother(model).Smooth(newTestMeasurements(model, 2)...)
+
+	e, ok := err.(*SingularCovarianceError)
+	if !ok {
+		t.Fatalf("expected a SingularCovarianceError, got %v", err)
+	}
+
+	if e.Index != 1 {
+		t.Errorf("expected the error at index 1, got %d", e.Index)
+	}
+}
+
+func TestDimensionMismatchError(t *testing.T) {
+	model := newTestModel()
+
+	observation := func(n int) func(mat.Vector) mat.Vector {
+		return func(state mat.Vector) mat.Vector {
+			return mat.NewVecDense(n, nil)
+		}
+	}
+
+	jacobian := func(state mat.Vector) mat.Matrix {
+		return mat.NewDense(1, 2, []float64{1, 0})
+	}
+
+	measurements := map[string]*models.Measurement{
+		"value": {
+			Covariance:       mat.NewDense(1, 1, []float64{0.1}),
+			ObservationModel: mat.NewDense(1, 2, []float64{1, 0}),
+		},
+		"covariance": {
+			Value:            mat.NewVecDense(1, []float64{1}),
+			ObservationModel: mat.NewDense(1, 2, []float64{1, 0}),
+		},
+		"observation model": {
+			Value:      mat.NewVecDense(1, []float64{1}),
+			Covariance: mat.NewDense(1, 1, []float64{0.1}),
+		},
+		"observation": models.NewNonlinearMeasurement(
+			mat.NewVecDense(1, []float64{1}),
+			mat.NewDense(1, 1, []float64{0.1}),
+			observation(2),
+			jacobian,
+		),
+	}
+
+	for name, m := range measurements {
+		ms := newTestMeasurements(model, 3)
+		ms[1] = NewMeasurementAtTime(ms[1].Time, m)
+
+		_, err := NewKalmanSmoother(model).Smooth(ms...)
+
+		e, ok := err.(*DimensionMismatchError)
+		if !ok {
+			t.Errorf("%s: expected a DimensionMismatchError, got %v", name, err)
+			continue
+		}
+
+		if e.Name != name || e.Index != 1 {
+			t.Errorf("%s: unexpected error: %s", name, e)
+		}
+	}
+}
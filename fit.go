@@ -0,0 +1,170 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+)
+
+// NoiseParameters are the variances of a model that may be estimated from data.
+// They correspond to the fields of configs such as models.BrownianModelConfig
+// and models.ConstantVelocityModelConfig.
+type NoiseParameters struct {
+	InitialVariance     float64
+	ProcessVariance     float64
+	ObservationVariance float64
+}
+
+// ModelConstructor builds a model using the given noise parameters.
+type ModelConstructor func(p NoiseParameters) models.LinearModel
+
+// FitConfig controls the estimation of noise parameters.
+type FitConfig struct {
+	// Initial is the starting point of the optimization. All variances must be positive.
+	Initial NoiseParameters
+
+	// Parameters that are fixed keep their initial values.
+	// When the ObservationVariance is fixed, the covariances of the measurements are used as given.
+	// Otherwise, the covariance of each measurement is replaced by ObservationVariance
+	// times the identity.
+	FixInitialVariance     bool
+	FixProcessVariance     bool
+	FixObservationVariance bool
+
+	// Method is the optimization method used, defaults to Nelder-Mead if nil.
+	Method optimize.Method
+	// Settings are passed to the optimizer, defaults are used if nil.
+	Settings *optimize.Settings
+}
+
+// FitResult holds the maximum-likelihood estimate of the noise parameters.
+type FitResult struct {
+	Parameters    NoiseParameters
+	LogLikelihood float64
+	Status        optimize.Status
+}
+
+// FitNoiseParameters estimates the noise parameters of a model by maximizing the
+// log-likelihood of the given measurements, as computed by a KalmanFilter.
+// The optimization is performed over the logarithm of each variance, so that
+// the variances remain positive.
+func FitNoiseParameters(constructor ModelConstructor, measurements []*MeasurementAtTime, cfg FitConfig) (*FitResult, error) {
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("no measurements to fit")
+	}
+
+	initial := []float64{
+		cfg.Initial.InitialVariance,
+		cfg.Initial.ProcessVariance,
+		cfg.Initial.ObservationVariance,
+	}
+	fixed := []bool{
+		cfg.FixInitialVariance,
+		cfg.FixProcessVariance,
+		cfg.FixObservationVariance,
+	}
+
+	var free []int
+	var x0 []float64
+	for i, v := range initial {
+		if fixed[i] {
+			continue
+		}
+
+		if v <= 0 {
+			return nil, fmt.Errorf("initial variances must be positive: %v", cfg.Initial)
+		}
+
+		free = append(free, i)
+		x0 = append(x0, math.Log(v))
+	}
+
+	parameters := func(x []float64) NoiseParameters {
+		values := append([]float64(nil), initial...)
+		for j, i := range free {
+			values[i] = math.Exp(x[j])
+		}
+
+		return NoiseParameters{
+			InitialVariance:     values[0],
+			ProcessVariance:     values[1],
+			ObservationVariance: values[2],
+		}
+	}
+
+	logLikelihood := func(p NoiseParameters) (float64, error) {
+		ms := measurements
+		if !cfg.FixObservationVariance {
+			ms = withObservationVariance(measurements, p.ObservationVariance)
+		}
+
+		total, _, err := NewKalmanSmoother(constructor(p)).LogLikelihood(ms...)
+		return total, err
+	}
+
+	// Errors such as unsorted measurements don't depend on the parameters, so they are
+	// returned from the starting point rather than being hidden from the optimizer.
+	ll, err := logLikelihood(parameters(x0))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(free) == 0 {
+		return &FitResult{
+			Parameters:    cfg.Initial,
+			LogLikelihood: ll,
+			Status:        optimize.Success,
+		}, nil
+	}
+
+	problem := optimize.Problem{
+		Func: func(x []float64) float64 {
+			ll, err := logLikelihood(parameters(x))
+			if err != nil || math.IsNaN(ll) {
+				return math.Inf(1)
+			}
+
+			return -ll
+		},
+	}
+
+	method := cfg.Method
+	if method == nil {
+		method = &optimize.NelderMead{}
+	}
+
+	result, err := optimize.Minimize(problem, x0, cfg.Settings, method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fit noise parameters: %s", err)
+	}
+
+	return &FitResult{
+		Parameters:    parameters(result.X),
+		LogLikelihood: -result.F,
+		Status:        result.Status,
+	}, nil
+}
+
+// withObservationVariance returns copies of the measurements with each covariance
+// replaced by the given variance times the identity.
+func withObservationVariance(measurements []*MeasurementAtTime, variance float64) []*MeasurementAtTime {
+	result := make([]*MeasurementAtTime, len(measurements))
+
+	for i, m := range measurements {
+		n := m.Value.Len()
+
+		covariance := mat.NewDense(n, n, nil)
+		for j := 0; j < n; j++ {
+			covariance.Set(j, j, variance)
+		}
+
+		copied := *m
+		copied.Covariance = covariance
+		result[i] = &copied
+	}
+
+	return result
+}
@@ -0,0 +1,36 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+func newTestModelConstructor() ModelConstructor {
+	return func(p NoiseParameters) models.LinearModel {
+		return models.NewConstantVelocityModel(
+			time.Time{},
+			mat.NewVecDense(1, nil),
+			models.ConstantVelocityModelConfig{
+				InitialVariance: p.InitialVariance,
+				ProcessVariance: p.ProcessVariance,
+			},
+		)
+	}
+}
+
+func TestFitNoiseParametersWithUnsortedMeasurementsIsAnError(t *testing.T) {
+	ms := newTestMeasurements(newTestModel(), 5)
+	ms[2], ms[3] = ms[3], ms[2]
+
+	cfg := FitConfig{
+		Initial: NoiseParameters{InitialVariance: 1, ProcessVariance: 0.1, ObservationVariance: 0.1},
+	}
+
+	_, err := FitNoiseParameters(newTestModelConstructor(), ms, cfg)
+	if _, ok := err.(*UnsortedMeasurementError); !ok {
+		t.Errorf("expected an UnsortedMeasurementError, got %v", err)
+	}
+}
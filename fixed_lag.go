@@ -0,0 +1,118 @@
+package kalman
+
+import (
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+)
+
+// FixedLagSmootherConfig controls how long the FixedLagSmoother waits before emitting
+// a smoothed estimate. An estimate is emitted once either criterion is met, criteria
+// that are zero are ignored. If both are zero, estimates are emitted immediately,
+// and so are the same as those of a KalmanFilter.
+type FixedLagSmootherConfig struct {
+	// Lag is the time by which the latest measurement must follow a measurement
+	// before the estimate at that measurement is emitted.
+	Lag time.Duration
+	// Steps is the number of measurements that must follow a measurement
+	// before the estimate at that measurement is emitted.
+	Steps int
+}
+
+// FixedLagSmoother consumes measurements incrementally and emits smoothed estimates
+// delayed by a fixed lag. Each estimate is smoothed using all measurements received
+// up to the point at which it is emitted.
+type FixedLagSmoother struct {
+	model  models.LinearModel
+	cfg    FixedLagSmootherConfig
+	filter *KalmanFilter
+
+	// The state changes of the measurements that have not yet been emitted.
+	window []kalmanStateChange
+}
+
+// NewFixedLagSmoother creates a new fixed-lag smoother for the given model.
+func NewFixedLagSmoother(model models.LinearModel, cfg FixedLagSmootherConfig) *FixedLagSmoother {
+	return &FixedLagSmoother{
+		model:  model,
+		cfg:    cfg,
+		filter: NewKalmanFilter(model),
+	}
+}
+
+// SetUpdateConfig selects how measurements are fused by the smoother.
+func (s *FixedLagSmoother) SetUpdateConfig(cfg UpdateConfig) {
+	s.filter.SetUpdateConfig(cfg)
+}
+
+// Update fuses the measurement taken at time t, returning the smoothed estimates
+// that have become older than the lag as a result, in order of time.
+// Measurements must be given in order of time.
+// If an error is returned, the measurement is discarded and the smoother is unchanged.
+func (s *FixedLagSmoother) Update(t time.Time, m *models.Measurement) ([]models.State, error) {
+	// The filter may have been advanced to t before the measurement failed to be fused,
+	// in which case the next state change would no longer follow the last in the window.
+	checkpoint := s.filter.Checkpoint()
+
+	stateChange, err := forwardStep(s.filter, s.model, NewMeasurementAtTime(t, m))
+	if err != nil {
+		s.filter.Restore(checkpoint)
+		return nil, err
+	}
+
+	s.window = append(s.window, *stateChange)
+
+	n := 0
+	for n < len(s.window) && s.ready(n) {
+		n++
+	}
+
+	if n == 0 {
+		return make([]models.State, 0), nil
+	}
+
+	return s.emit(n)
+}
+
+// Flush returns the smoothed estimates of all measurements that have not yet been emitted,
+// in order of time.
+func (s *FixedLagSmoother) Flush() ([]models.State, error) {
+	if len(s.window) == 0 {
+		return make([]models.State, 0), nil
+	}
+
+	return s.emit(len(s.window))
+}
+
+// ready returns true if the estimate at index i of the window may be emitted.
+func (s *FixedLagSmoother) ready(i int) bool {
+	if s.cfg.Lag == 0 && s.cfg.Steps == 0 {
+		return true
+	}
+
+	latest := len(s.window) - 1
+
+	if s.cfg.Steps > 0 && latest-i >= s.cfg.Steps {
+		return true
+	}
+
+	if s.cfg.Lag > 0 && s.window[latest].time.Sub(s.window[i].time) >= s.cfg.Lag {
+		return true
+	}
+
+	return false
+}
+
+// emit smooths the window, removing and returning the first n estimates.
+func (s *FixedLagSmoother) emit(n int) ([]models.State, error) {
+	smoothed, err := smoothBackwards(s.window)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discarding the emitted state changes doesn't affect later passes, since the
+	// smoothed estimate of each state only depends on the state changes that follow it.
+	s.window = append([]kalmanStateChange(nil), s.window[n:]...)
+
+	return smoothed.states[:n], nil
+}
@@ -0,0 +1,70 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// updateFixedLag feeds the measurements to a FixedLagSmoother, returning the emitted estimates.
+func updateFixedLag(t *testing.T, s *FixedLagSmoother, measurements []*MeasurementAtTime) []models.State {
+	t.Helper()
+
+	var result []models.State
+	for _, m := range measurements {
+		states, err := s.Update(m.Time, &m.Measurement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result = append(result, states...)
+	}
+
+	return result
+}
+
+func TestFixedLagSmootherMatchesSmoother(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 10)
+
+	expected, err := NewKalmanSmoother(model).Smooth(ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A lag longer than the measurements defers all estimates to Flush,
+	// at which point they are smoothed using all measurements.
+	cfg := FixedLagSmootherConfig{Steps: len(ms)}
+
+	invalid := &models.Measurement{
+		Value:            mat.NewVecDense(1, []float64{100}),
+		Covariance:       mat.NewDense(2, 2, nil),
+		ObservationModel: mat.NewDense(1, 2, []float64{1, 0}),
+	}
+
+	for _, failedUpdate := range []bool{false, true} {
+		s := NewFixedLagSmoother(model, cfg)
+		emitted := updateFixedLag(t, s, ms[:5])
+
+		if failedUpdate {
+			_, err := s.Update(ms[4].Time.Add(500*time.Millisecond), invalid)
+			if err == nil {
+				t.Fatal("expected an error for an invalid measurement")
+			}
+		}
+
+		emitted = append(emitted, updateFixedLag(t, s, ms[5:])...)
+		if len(emitted) != 0 {
+			t.Fatalf("expected no estimates before flushing, got %d", len(emitted))
+		}
+
+		actual, err := s.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertStatesNear(t, expected, actual, 1e-9)
+	}
+}
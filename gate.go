@@ -0,0 +1,44 @@
+package kalman
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// GateAction selects what happens to a measurement that falls outside of a Gate.
+type GateAction int
+
+const (
+	// RejectOutliers discards measurements that fall outside of the gate.
+	RejectOutliers GateAction = iota
+	// DownWeightOutliers fuses measurements that fall outside of the gate, but inflates
+	// their covariance by the ratio of their normalized innovation squared to the gate threshold.
+	DownWeightOutliers
+)
+
+// Gate is used to detect outlying measurements. A measurement falls outside of the gate when
+// its normalized innovation squared exceeds the quantile of the chi-square distribution
+// given by Probability, with degrees of freedom equal to the dimension of the measurement.
+// For example, a Probability of 0.99 is expected to misclassify 1% of valid measurements
+// as outliers. Probability must be strictly between 0 and 1, measurements fused with
+// a gate of any other Probability return an error.
+type Gate struct {
+	Probability float64
+	Action      GateAction
+}
+
+// Threshold returns the largest normalized innovation squared accepted by the gate
+// for a measurement with the given number of dimensions.
+func (g *Gate) Threshold(dims int) float64 {
+	return distuv.ChiSquared{K: float64(dims)}.Quantile(g.Probability)
+}
+
+// validate returns an error if the gate would reject or down-weight every measurement.
+func (g *Gate) validate() error {
+	if !(g.Probability > 0 && g.Probability < 1) {
+		return fmt.Errorf("gate probability must be between 0 and 1, got %v", g.Probability)
+	}
+
+	return nil
+}
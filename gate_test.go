@@ -0,0 +1,49 @@
+package kalman
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestGateRejectsOutliers(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 2)
+
+	filter := NewKalmanFilter(model)
+	filter.SetUpdateConfig(UpdateConfig{Gate: &Gate{Probability: 0.99}})
+
+	result, err := filter.UpdateWithResult(ms[0].Time, &ms[0].Measurement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rejected {
+		t.Fatal("expected an inlying measurement to be fused")
+	}
+
+	outlier := model.NewPositionMeasurement(mat.NewVecDense(1, []float64{100}), 0.1)
+	result, err = filter.UpdateWithResult(ms[1].Time, outlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Rejected {
+		t.Fatal("expected an outlying measurement to be rejected")
+	}
+}
+
+func TestGateWithInvalidProbabilityIsAnError(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 1)
+
+	for _, probability := range []float64{0, -0.5, 1, 2} {
+		for _, action := range []GateAction{RejectOutliers, DownWeightOutliers} {
+			filter := NewKalmanFilter(model)
+			filter.SetUpdateConfig(UpdateConfig{Gate: &Gate{Probability: probability, Action: action}})
+
+			err := filter.Update(ms[0].Time, &ms[0].Measurement)
+			if err == nil {
+				t.Errorf("expected an error for gate probability %v", probability)
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package kalman
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// filterEstimate is a copy of the estimate held by a KalmanFilter at a given time.
+type filterEstimate struct {
+	t             time.Time
+	state         *mat.VecDense
+	covariance    *mat.Dense
+	logLikelihood float64
+}
+
+// filterRecord is a measurement fused by a KalmanFilter, along with the
+// estimate of the filter immediately after it was fused.
+type filterRecord struct {
+	t           time.Time
+	measurement *models.Measurement
+	after       filterEstimate
+}
+
+// SetHistoryLength enables fusing out-of-sequence measurements, by retaining the given number
+// of most recently fused measurements. When a measurement arrives with a time earlier than the
+// current time of the filter, the filter is rewound to the latest retained estimate preceding
+// the measurement, and the retained measurements following it are fused again in order.
+// Measurements older than all retained measurements can't be fused.
+// A length of zero disables the history, which is the default.
+// Setting the history length discards any history already retained.
+// Control inputs are not retained, so PredictWithControl also discards the history,
+// and measurements can't be fused out of sequence across a control input.
+func (kf *KalmanFilter) SetHistoryLength(n int) {
+	kf.historyLength = n
+	kf.resetHistory()
+}
+
+// resetHistory discards the retained history, so that the current estimate is the
+// oldest estimate that the filter can be rewound to.
+func (kf *KalmanFilter) resetHistory() {
+	kf.history = nil
+	kf.historyBase = kf.estimate()
+}
+
+// estimate returns a copy of the current estimate of the filter.
+func (kf *KalmanFilter) estimate() filterEstimate {
+	return filterEstimate{
+		t:             kf.t,
+		state:         mat.VecDenseCopyOf(kf.state),
+		covariance:    mat.DenseCopyOf(kf.covariance),
+		logLikelihood: kf.logLikelihood,
+	}
+}
+
+// restore resets the filter to the given estimate.
+func (kf *KalmanFilter) restore(e filterEstimate) {
+	kf.t = e.t
+	kf.state = mat.VecDenseCopyOf(e.state)
+	kf.covariance = mat.DenseCopyOf(e.covariance)
+	kf.logLikelihood = e.logLikelihood
+}
+
+// record adds a copy of a fused measurement to the history, discarding the oldest
+// measurement if the history is full.
+func (kf *KalmanFilter) record(t time.Time, m *models.Measurement) {
+	if kf.historyLength == 0 {
+		return
+	}
+
+	kf.history = append(kf.history, filterRecord{
+		t:           t,
+		measurement: copyMeasurement(m),
+		after:       kf.estimate(),
+	})
+
+	if len(kf.history) > kf.historyLength {
+		kf.historyBase = kf.history[0].after
+
+		// Re-slicing doesn't copy, and append only copies the retained records
+		// once the capacity is exhausted, so trimming is amortized constant time.
+		kf.history = kf.history[1:]
+	}
+}
+
+// copyMeasurement returns a copy of the measurement that doesn't share the
+// value and matrices of the original, which the caller may go on to modify.
+func copyMeasurement(m *models.Measurement) *models.Measurement {
+	result := *m
+	result.Value = mat.VecDenseCopyOf(m.Value)
+	result.Covariance = mat.DenseCopyOf(m.Covariance)
+
+	if m.ObservationModel != nil {
+		result.ObservationModel = mat.DenseCopyOf(m.ObservationModel)
+	}
+
+	return &result
+}
+
+// Checkpoint is a snapshot of the estimate and retained history of a KalmanFilter,
+// which the filter can later be rolled back to using Restore.
+type Checkpoint struct {
+	estimate    filterEstimate
+	history     []filterRecord
+	historyBase filterEstimate
+}
+
+// Time returns the time of the estimate held by the checkpoint.
+func (c *Checkpoint) Time() time.Time {
+	return c.estimate.t
+}
+
+// Checkpoint returns a snapshot of the current state of the filter.
+func (kf *KalmanFilter) Checkpoint() *Checkpoint {
+	return &Checkpoint{
+		estimate:    kf.estimate(),
+		history:     append([]filterRecord(nil), kf.history...),
+		historyBase: kf.historyBase,
+	}
+}
+
+// Restore rolls the filter back (or forwards) to the given checkpoint,
+// including the history of measurements retained at the time of the checkpoint.
+func (kf *KalmanFilter) Restore(c *Checkpoint) {
+	kf.restore(c.estimate)
+	kf.history = append([]filterRecord(nil), c.history...)
+	kf.historyBase = c.historyBase
+}
+
+// History returns the measurements retained by the filter, oldest first.
+// See SetHistoryLength.
+func (kf *KalmanFilter) History() []*MeasurementAtTime {
+	result := make([]*MeasurementAtTime, len(kf.history))
+	for i, r := range kf.history {
+		result[i] = NewMeasurementAtTime(r.t, r.measurement)
+	}
+
+	return result
+}
+
+// Rewind undoes the fusion of all retained measurements taken at or after the given time,
+// returning the estimate of the filter to that following the last measurement before it.
+// The measurements that were undone are returned oldest first, so that they may be
+// corrected and fused again, for example using Replay.
+// An error is returned if the filter does not retain measurements as old as the given time,
+// or if it does not retain measurements at all, see SetHistoryLength.
+func (kf *KalmanFilter) Rewind(t time.Time) ([]*MeasurementAtTime, error) {
+	if kf.historyLength == 0 {
+		return nil, fmt.Errorf("can't rewind, the filter does not retain a history of measurements")
+	}
+
+	i := sort.Search(len(kf.history), func(i int) bool {
+		return !kf.history[i].t.Before(t)
+	})
+
+	rewindTo := kf.historyBase
+	if i > 0 {
+		rewindTo = kf.history[i-1].after
+	}
+
+	if t.Before(rewindTo.t) {
+		return nil, fmt.Errorf("can't rewind to %s, it is older than the retained history", t)
+	}
+
+	undone := kf.History()[i:]
+	kf.history = append([]filterRecord(nil), kf.history[:i]...)
+	kf.restore(rewindTo)
+
+	return undone, nil
+}
+
+// Replay fuses the given measurements into the filter in order of time.
+func (kf *KalmanFilter) Replay(measurements ...*MeasurementAtTime) error {
+	sorted := append([]*MeasurementAtTime(nil), measurements...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	for _, m := range sorted {
+		err := kf.Update(m.Time, &m.Measurement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateOutOfSequence fuses a measurement older than the current time of the filter,
+// by rewinding the filter and replaying the retained measurements that follow it.
+func (kf *KalmanFilter) updateOutOfSequence(t time.Time, m *models.Measurement) (*UpdateResult, error) {
+	// Measurements at the same time as a retained measurement are fused after it.
+	i := sort.Search(len(kf.history), func(i int) bool {
+		return kf.history[i].t.After(t)
+	})
+
+	rewindTo := kf.historyBase
+	if i > 0 {
+		rewindTo = kf.history[i-1].after
+	}
+
+	if t.Before(rewindTo.t) {
+		return nil, fmt.Errorf("can't predict past: %s is older than the retained history", t)
+	}
+
+	end := kf.t
+	current := kf.estimate()
+	history := kf.history
+	historyBase := kf.historyBase
+
+	replay := append([]filterRecord(nil), kf.history[i:]...)
+	kf.history = append([]filterRecord(nil), kf.history[:i]...)
+	kf.restore(rewindTo)
+
+	result, err := kf.UpdateWithResult(t, m)
+
+	for j := 0; err == nil && j < len(replay); j++ {
+		_, err = kf.UpdateWithResult(replay[j].t, replay[j].measurement)
+	}
+
+	if err == nil {
+		err = kf.Predict(end)
+	}
+
+	if err != nil {
+		kf.restore(current)
+		kf.history = history
+		kf.historyBase = historyBase
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,169 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// TestOutOfSequenceMeasurement checks that fusing a late measurement gives the same estimate as
+// fusing all measurements in order, even when the caller reuses the same measurement value.
+func TestOutOfSequenceMeasurement(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 6)
+
+	inOrder := NewKalmanFilter(model)
+	for _, m := range ms {
+		if err := inOrder.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	late := ms[2]
+	filter := NewKalmanFilter(model)
+	filter.SetHistoryLength(10)
+
+	// A single measurement and value are reused for every update.
+	value := mat.NewVecDense(1, nil)
+	var reused models.Measurement
+
+	for i, m := range ms {
+		if i == 2 {
+			continue
+		}
+
+		value.CopyVec(m.Value)
+		reused = m.Measurement
+		reused.Value = value
+
+		if err := filter.Update(m.Time, &reused); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := filter.Update(late.Time, &late.Measurement); err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.Time().Equal(inOrder.Time()) {
+		t.Fatalf("expected time %s, got %s", inOrder.Time(), filter.Time())
+	}
+
+	assertVecNear(t, inOrder.State(), filter.State(), 1e-9)
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 10)
+
+	filter := NewKalmanFilter(model)
+	filter.SetHistoryLength(3)
+
+	for _, m := range ms {
+		if err := filter.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := filter.History()
+	if len(history) != 3 {
+		t.Fatalf("expected 3 retained measurements, got %d", len(history))
+	}
+
+	for i, m := range history {
+		expected := ms[len(ms)-3+i]
+		if !m.Time.Equal(expected.Time) {
+			t.Errorf("expected retained measurement at %s, got %s", expected.Time, m.Time)
+		}
+	}
+
+	// Measurements older than the retained history can't be fused.
+	err := filter.Update(ms[2].Time.Add(-time.Millisecond), &ms[2].Measurement)
+	if err == nil {
+		t.Errorf("expected an error for a measurement older than the retained history")
+	}
+}
+
+func TestRewindWithoutHistoryIsAnError(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 2)
+
+	filter := NewKalmanFilter(model)
+	if err := filter.Update(ms[0].Time, &ms[0].Measurement); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := mat.VecDenseCopyOf(filter.State())
+
+	for _, ts := range []time.Time{model.InitialState().Time, ms[0].Time, ms[1].Time} {
+		if _, err := filter.Rewind(ts); err == nil {
+			t.Errorf("expected an error rewinding to %s without a history", ts)
+		}
+	}
+
+	assertVecNear(t, expected, filter.State(), 0)
+}
+
+func TestRewindAndReplay(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 5)
+
+	filter := NewKalmanFilter(model)
+	filter.SetHistoryLength(10)
+
+	for _, m := range ms {
+		if err := filter.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := mat.VecDenseCopyOf(filter.State())
+
+	undone, err := filter.Rewind(ms[2].Time)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(undone) != 3 || !undone[0].Time.Equal(ms[2].Time) {
+		t.Fatalf("expected the last 3 measurements to be undone, got %d", len(undone))
+	}
+	if !filter.Time().Equal(ms[1].Time) {
+		t.Fatalf("expected the filter to be rewound to %s, got %s", ms[1].Time, filter.Time())
+	}
+
+	if err := filter.Replay(undone...); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVecNear(t, expected, filter.State(), 1e-12)
+}
+
+func TestNewKalmanFilterRetainsInitialEstimate(t *testing.T) {
+	model := newTestModel()
+	initial := model.InitialState()
+	m := newTestMeasurements(model, 1)[0]
+
+	filter := NewKalmanFilter(model)
+	filter.SetHistoryLength(5)
+
+	if err := filter.Update(m.Time, &m.Measurement); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := filter.Rewind(initial.Time)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(undone) != 1 {
+		t.Fatalf("expected 1 measurement to be undone, got %d", len(undone))
+	}
+
+	if !filter.Time().Equal(initial.Time) {
+		t.Errorf("expected time %s, got %s", initial.Time, filter.Time())
+	}
+
+	assertVecNear(t, initial.State, filter.State(), 0)
+	assertMatNear(t, initial.Covariance, filter.Covariance(), 0)
+}
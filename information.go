@@ -0,0 +1,259 @@
+package kalman
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// InformationFilter is the dual form of the KalmanFilter. Rather than the state x
+// and covariance P, it propagates the information matrix Y = P^-1 and the
+// information vector y = P^-1 x.
+// This makes it possible to start from no knowledge of the state at all (zero information),
+// and measurements are fused simply by adding their information contributions.
+// The transition matrices of the model must be invertible.
+type InformationFilter struct {
+	model models.LinearModel
+
+	dims              int
+	t                 time.Time
+	informationVector *mat.VecDense
+	informationMatrix *mat.Dense
+}
+
+// NewInformationFilter returns a new InformationFilter for the given linear model,
+// initialized from the initial state of the model.
+// An error is returned if the initial covariance of the model is not invertible.
+func NewInformationFilter(model models.LinearModel) (*InformationFilter, error) {
+	initial := model.InitialState()
+	dims := initial.State.Len()
+
+	if initial.Covariance == nil {
+		return nil, fmt.Errorf("missing initial covariance")
+	}
+
+	if r, c := initial.Covariance.Dims(); r != dims || c != dims {
+		return nil, fmt.Errorf("initial covariance has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims)
+	}
+
+	informationMatrix := mat.NewDense(dims, dims, nil)
+	err := informationMatrix.Inverse(initial.Covariance)
+	if err != nil {
+		return nil, fmt.Errorf("initial covariance is not invertible: %s", err)
+	}
+
+	informationVector := mat.NewVecDense(dims, nil)
+	informationVector.MulVec(informationMatrix, initial.State)
+
+	return &InformationFilter{
+		model:             model,
+		dims:              dims,
+		t:                 initial.Time,
+		informationVector: informationVector,
+		informationMatrix: informationMatrix,
+	}, nil
+}
+
+// NewUninformedInformationFilter returns a new InformationFilter for the given linear model
+// starting at the initial time of the model, but with zero information about the state.
+// The initial state and covariance of the model are ignored.
+func NewUninformedInformationFilter(model models.LinearModel) *InformationFilter {
+	initial := model.InitialState()
+	dims := initial.State.Len()
+
+	return &InformationFilter{
+		model:             model,
+		dims:              dims,
+		t:                 initial.Time,
+		informationVector: mat.NewVecDense(dims, nil),
+		informationMatrix: mat.NewDense(dims, dims, nil),
+	}
+}
+
+// InformationVector returns the current information vector y = P^-1 x.
+func (f *InformationFilter) InformationVector() mat.Vector {
+	return f.informationVector
+}
+
+// InformationMatrix returns the current information matrix Y = P^-1.
+func (f *InformationFilter) InformationMatrix() mat.Matrix {
+	return f.informationMatrix
+}
+
+// SetInformation resets the information vector and matrix of the filter to the given values.
+func (f *InformationFilter) SetInformation(informationVector mat.Vector, informationMatrix mat.Matrix) {
+	f.informationVector = mat.VecDenseCopyOf(informationVector)
+	f.informationMatrix = mat.DenseCopyOf(informationMatrix)
+}
+
+// Time returns the time for which the current information is an estimate.
+// The time is monotone increasing.
+func (f *InformationFilter) Time() time.Time {
+	return f.t
+}
+
+// Estimate returns the current state and covariance recovered from the information form.
+// An error is returned if the information matrix is singular, which is the case until
+// enough measurements have been fused to observe every component of the state.
+func (f *InformationFilter) Estimate() (models.State, error) {
+	covariance := mat.NewDense(f.dims, f.dims, nil)
+	err := covariance.Inverse(f.informationMatrix)
+	if err != nil {
+		return models.State{}, fmt.Errorf("information matrix is singular: %s", err)
+	}
+
+	state := mat.NewVecDense(f.dims, nil)
+	state.MulVec(covariance, f.informationVector)
+
+	return models.State{
+		Time:       f.t,
+		State:      state,
+		Covariance: covariance,
+	}, nil
+}
+
+// Predict advances the filter from the internal current time
+// to the given time using the built-in linear model.
+// Each time can be no earlier than the current time of the filter.
+func (f *InformationFilter) Predict(t time.Time) error {
+	if t.Before(f.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.Equal(f.t) {
+		return nil
+	}
+
+	dt := t.Sub(f.t)
+
+	TInv := mat.NewDense(f.dims, f.dims, nil)
+	err := TInv.Inverse(f.model.Transition(dt))
+	if err != nil {
+		return fmt.Errorf("transition is not invertible: %s", err)
+	}
+
+	Q := f.model.CovarianceTransition(dt)
+
+	// M = T^-T Y T^-1 is the information after a noiseless transition.
+	M := mat.NewDense(f.dims, f.dims, nil)
+	M.Product(TInv.T(), f.informationMatrix, TInv)
+
+	// The process noise removes information C M, where C = M(I + QM)^-1 Q.
+	// This form avoids inverting either Q or M, so that both may be singular.
+	QM := mat.NewDense(f.dims, f.dims, nil)
+	QM.Mul(Q, M)
+	QM.Add(eye(f.dims), QM)
+
+	// X = (I + QM)^-1 Q
+	X := mat.NewDense(f.dims, f.dims, nil)
+	err = X.Solve(QM, Q)
+	if err != nil {
+		return fmt.Errorf("failed to apply process noise: %s", err)
+	}
+
+	C := mat.NewDense(f.dims, f.dims, nil)
+	C.Mul(M, X)
+
+	IMinusC := mat.NewDense(f.dims, f.dims, nil)
+	IMinusC.Sub(eye(f.dims), C)
+
+	informationMatrix := mat.NewDense(f.dims, f.dims, nil)
+	informationMatrix.Mul(IMinusC, M)
+
+	informationVector := mat.NewVecDense(f.dims, nil)
+	informationVector.MulVec(TInv.T(), f.informationVector)
+	informationVector.MulVec(IMinusC, informationVector)
+
+	f.informationMatrix = informationMatrix
+	f.informationVector = informationVector
+	f.t = t
+
+	return nil
+}
+
+// Update is used to take a new measurement from a sensor and fuse it to the model.
+// The information contributed by a measurement is simply added to the current information.
+// Nonlinear measurements are linearized about the current state estimate, which must
+// therefore exist.
+// The time field must be no earlier than the current time of the filter.
+func (f *InformationFilter) Update(t time.Time, m *models.Measurement) error {
+	if t.Before(f.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.After(f.t) {
+		err := f.Predict(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Linear measurements are checked against the information vector, since only
+	// the number of entries of the state is needed.
+	x := mat.Vector(f.informationVector)
+
+	if m.IsNonlinear() {
+		err := checkJacobian(m)
+		if err != nil {
+			return err
+		}
+
+		estimate, err := f.Estimate()
+		if err != nil {
+			return fmt.Errorf("can't linearize measurement: %s", err)
+		}
+
+		x = estimate.State
+	}
+
+	err := checkMeasurement(m, x)
+	if err != nil {
+		return err
+	}
+
+	z := mat.VecDenseCopyOf(m.Value)
+	H := m.ObservationModel
+
+	if m.IsNonlinear() {
+		// Linearizing h(x) ~ h(x0) + H(x - x0) gives the pseudo-measurement z - h(x0) + Hx0.
+		H = m.Jacobian(x)
+		Hx := mat.NewVecDense(z.Len(), nil)
+		Hx.MulVec(H, x)
+
+		z.SubVec(z, m.Observe(x))
+		z.AddVec(z, Hx)
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(m.Covariance)); !ok {
+		return fmt.Errorf("measurement covariance is not positive definite")
+	}
+
+	RInvH := mat.NewDense(z.Len(), f.dims, nil)
+	err = chol.SolveTo(RInvH, H)
+	if err != nil {
+		return fmt.Errorf("measurement covariance is singular: %s", err)
+	}
+
+	RInvz := mat.NewVecDense(z.Len(), nil)
+	err = chol.SolveVecTo(RInvz, z)
+	if err != nil {
+		return fmt.Errorf("measurement covariance is singular: %s", err)
+	}
+
+	informationMatrix := mat.NewDense(f.dims, f.dims, nil)
+	informationMatrix.Mul(H.T(), RInvH)
+	informationMatrix.Add(f.informationMatrix, informationMatrix)
+
+	informationVector := mat.NewVecDense(f.dims, nil)
+	informationVector.MulVec(H.T(), RInvz)
+	informationVector.AddVec(f.informationVector, informationVector)
+
+	f.informationMatrix = informationMatrix
+	f.informationVector = informationVector
+	f.t = t
+
+	return nil
+}
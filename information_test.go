@@ -0,0 +1,104 @@
+package kalman
+
+import (
+	"testing"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+func newTestInformationFilter(t *testing.T, model models.LinearModel) *InformationFilter {
+	t.Helper()
+
+	filter, err := NewInformationFilter(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filter
+}
+
+func TestInformationFilterMatchesKalmanFilter(t *testing.T) {
+	model := newTestModel()
+	expected := NewKalmanFilter(model)
+	actual := newTestInformationFilter(t, model)
+
+	for _, m := range newTestMeasurements(model, 10) {
+		if err := expected.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := actual.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+
+		estimate, err := actual.Estimate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertVecNear(t, expected.State(), estimate.State, 1e-9)
+		assertMatNear(t, expected.Covariance(), estimate.Covariance, 1e-9)
+	}
+}
+
+func TestUninformedInformationFilterIgnoresInitialState(t *testing.T) {
+	model := newTestModel()
+	filter := NewUninformedInformationFilter(model)
+	ms := newTestMeasurements(model, 3)
+
+	for i, m := range ms {
+		if err := filter.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+
+		// A single measurement of the position doesn't observe the velocity.
+		_, err := filter.Estimate()
+		if i == 0 && err == nil {
+			t.Errorf("expected an error estimating from a single measurement")
+		}
+	}
+
+	estimate, err := filter.Estimate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertVecNear(t, mat.NewVecDense(2, []float64{3, 1}), estimate.State, 0.1)
+}
+
+func TestInformationFilterWithInvalidCovarianceIsAnError(t *testing.T) {
+	covariances := map[string]mat.Matrix{
+		"singular":   mat.NewDense(2, 2, nil),
+		"wrong size": mat.NewDense(1, 1, []float64{1}),
+		"missing":    nil,
+	}
+
+	for name, covariance := range covariances {
+		model := models.NewContinuousLinearModel(
+			models.State{State: mat.NewVecDense(2, nil), Covariance: covariance},
+			mat.NewDense(2, 2, nil),
+			mat.NewDense(2, 2, nil),
+		)
+
+		if _, err := NewInformationFilter(model); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInformationFilterWithMismatchedMeasurementIsAnError(t *testing.T) {
+	model := newTestModel()
+	filter := newTestInformationFilter(t, model)
+
+	m := &models.Measurement{
+		Value:            mat.NewVecDense(1, []float64{1}),
+		Covariance:       mat.NewDense(1, 1, []float64{0.1}),
+		ObservationModel: mat.NewDense(1, 3, []float64{1, 0, 0}),
+	}
+
+	err := filter.Update(model.InitialState().Time, m)
+	if _, ok := err.(*DimensionMismatchError); !ok {
+		t.Errorf("expected a DimensionMismatchError, got %v", err)
+	}
+}
@@ -17,26 +17,35 @@ import (
 // is a time series, and that the time steps are non-uniform and specified
 // for each update and prediction operation.
 type KalmanFilter struct {
-	model models.LinearModel
+	model        models.LinearModel
+	updateConfig UpdateConfig
 
 	dims       int
 	t          time.Time
 	state      *mat.VecDense
 	covariance *mat.Dense
+
+	logLikelihood float64
+
+	historyLength int
+	history       []filterRecord
+	historyBase   filterEstimate
 }
 
 // NewKalmanFilter returns a new KalmanFilter for the given linear model.
 func NewKalmanFilter(model models.LinearModel) *KalmanFilter {
 	initial := model.InitialState()
 
-	return &KalmanFilter{
+	kf := &KalmanFilter{
 		model:      model,
 		dims:       initial.State.Len(),
 		t:          initial.Time,
 		state:      mat.VecDenseCopyOf(initial.State),
 		covariance: mat.DenseCopyOf(initial.Covariance),
 	}
+	kf.resetHistory()
 
+	return kf
 }
 
 // State returns the current hidden state of the KalmanFilter.
@@ -53,13 +62,30 @@ func (kf *KalmanFilter) Covariance() mat.Matrix {
 }
 
 // SetCovariance resets the covariance of the Kalman Filter to the given value.
+// Any retained history of measurements is discarded.
 func (kf *KalmanFilter) SetCovariance(covariance mat.Matrix) {
 	kf.covariance = mat.DenseCopyOf(covariance)
+	kf.resetHistory()
 }
 
 // SetState resets the state of the Kalman Filter to the given value.
+// Any retained history of measurements is discarded.
 func (kf *KalmanFilter) SetState(state mat.Vector) {
 	kf.state = mat.VecDenseCopyOf(state)
+	kf.resetHistory()
+}
+
+// SetUpdateConfig selects how measurements are fused into the state and covariance.
+func (kf *KalmanFilter) SetUpdateConfig(cfg UpdateConfig) {
+	kf.updateConfig = cfg
+}
+
+// LogLikelihood returns the accumulated log-likelihood of all measurements fused
+// by the filter, given the predictions of the model.
+// The contribution of each measurement is provided by UpdateWithResult.
+// Measurements rejected by a gate do not contribute.
+func (kf *KalmanFilter) LogLikelihood() float64 {
+	return kf.logLikelihood
 }
 
 // Time returns the time for which the current hidden state is an estimate.
@@ -73,6 +99,51 @@ func (kf *KalmanFilter) Time() time.Time {
 // The state of the filter is updated and the current time is updated.
 // Each time can be no earlier than the current time of the filter.
 func (kf *KalmanFilter) Predict(t time.Time) error {
+	return kf.predict(t, nil)
+}
+
+// PredictWithControl is identical to Predict, but also applies the known control input u,
+// which is assumed constant between the current time of the filter and the given time.
+// The model of the filter must implement models.ControlModel.
+// Control inputs are not retained in the history of the filter, so any retained
+// history of measurements is discarded.
+func (kf *KalmanFilter) PredictWithControl(t time.Time, u mat.Vector) error {
+	model, ok := kf.model.(models.ControlModel)
+	if !ok {
+		return fmt.Errorf("model does not accept control inputs")
+	}
+
+	if u == nil {
+		return fmt.Errorf("missing control input")
+	}
+
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	B := model.ControlTransition(t.Sub(kf.t))
+	if r, c := B.Dims(); r != kf.dims || c != u.Len() {
+		return fmt.Errorf(
+			"control transition of size %dx%d can't map a control input of %d entries to a state of %d entries",
+			r, c, u.Len(), kf.dims,
+		)
+	}
+
+	control := mat.NewVecDense(kf.dims, nil)
+	control.MulVec(B, u)
+
+	err := kf.predict(t, control)
+	if err != nil {
+		return err
+	}
+
+	kf.resetHistory()
+	return nil
+}
+
+// predict advances the filter to time t, adding the given change in the state due
+// to control inputs, if any.
+func (kf *KalmanFilter) predict(t time.Time, control mat.Vector) error {
 	if t.Before(kf.t) {
 		return fmt.Errorf("can't predict past: %s", t)
 	}
@@ -90,6 +161,10 @@ func (kf *KalmanFilter) Predict(t time.Time) error {
 
 	kf.state.MulVec(T, kf.state)
 
+	if control != nil {
+		kf.state.AddVec(kf.state, control)
+	}
+
 	newCovariance := mat.NewDense(kf.dims, kf.dims, nil)
 	newCovariance.Product(T, P, T.T())
 	kf.covariance.Add(newCovariance, Q)
@@ -98,52 +173,51 @@ func (kf *KalmanFilter) Predict(t time.Time) error {
 }
 
 // Update is used to take a new measurement from a sensor and fuse it to the model.
-// The time field must be no earlier than the current time of the filter.
+// Nonlinear measurements are linearized about the current state estimate.
+// An error is returned if the innovation covariance of the measurement is singular,
+// in which case the measurement is not fused.
+// The time field must be no earlier than the current time of the filter, unless
+// the filter retains a history of measurements, see SetHistoryLength.
 func (kf *KalmanFilter) Update(t time.Time, m *models.Measurement) error {
+	_, err := kf.UpdateWithResult(t, m)
+	return err
+}
+
+// UpdateWithResult is identical to Update, but also returns the intermediate
+// quantities computed whilst fusing the measurement, such as the innovation
+// and the Kalman gain.
+func (kf *KalmanFilter) UpdateWithResult(t time.Time, m *models.Measurement) (*UpdateResult, error) {
 	if t.Before(kf.t) {
-		return fmt.Errorf("can't predict past: %s", t)
+		if kf.historyLength > 0 {
+			return kf.updateOutOfSequence(t, m)
+		}
+
+		return nil, fmt.Errorf("can't predict past: %s", t)
 	}
 
 	if t.After(kf.t) {
 		err := kf.Predict(t)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	z := m.Value
-	R := m.Covariance
-	H := m.ObservationModel
-	P := kf.covariance
-
-	preFitResidual := mat.NewVecDense(z.Len(), nil)
-	preFitResidual.MulVec(H, kf.state)
-	preFitResidual.SubVec(z, preFitResidual)
-
-	preFitResidualCov := mat.NewDense(z.Len(), z.Len(), nil)
-	preFitResidualCov.Product(H, P, H.T())
-	preFitResidualCov.Add(preFitResidualCov, R)
-
-	preFitResidualCovInv := mat.NewDense(z.Len(), z.Len(), nil)
-	preFitResidualCovInv.Inverse(preFitResidualCov)
-
-	gain := mat.NewDense(kf.dims, z.Len(), nil)
-	gain.Product(P, H.T(), preFitResidualCovInv)
+	p, err := measurementUpdate(kf.state, kf.covariance, m, kf.updateConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	newState := mat.NewVecDense(kf.dims, nil)
-	newState.MulVec(gain, preFitResidual)
-	newState.AddVec(kf.state, newState)
+	kf.state = p.state
+	kf.covariance = p.covariance
+	kf.t = t
 
-	newCovariance := mat.NewDense(kf.dims, kf.dims, nil)
-	newCovariance.Mul(gain, H)
-	newCovariance.Sub(eye(kf.dims), newCovariance)
-	newCovariance.Mul(newCovariance, P)
+	if !p.result.Rejected {
+		kf.logLikelihood += p.result.LogLikelihood
+	}
 
-	kf.covariance = newCovariance
-	kf.state = newState
-	kf.t = t
+	kf.record(t, m)
 
-	return nil
+	return p.result, nil
 }
 
 func eye(n int) *mat.Dense {
@@ -153,3 +227,15 @@ func eye(n int) *mat.Dense {
 	}
 	return result
 }
+
+// symmetrize returns the symmetric part of the given square matrix, (A + A^T) / 2.
+func symmetrize(a mat.Matrix) *mat.SymDense {
+	n, _ := a.Dims()
+	result := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			result.SetSym(i, j, 0.5*(a.At(i, j)+a.At(j, i)))
+		}
+	}
+	return result
+}
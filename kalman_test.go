@@ -0,0 +1,125 @@
+package kalman
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// newTestModel returns a one-dimensional constant velocity model starting at rest at the origin.
+func newTestModel() *models.ConstantVelocityModel {
+	return models.NewConstantVelocityModel(
+		time.Time{},
+		mat.NewVecDense(1, nil),
+		models.ConstantVelocityModelConfig{InitialVariance: 1, ProcessVariance: 0.1},
+	)
+}
+
+// newTestMeasurements returns n position measurements of a particle moving with unit velocity,
+// taken once per second.
+func newTestMeasurements(model *models.ConstantVelocityModel, n int) []*MeasurementAtTime {
+	result := make([]*MeasurementAtTime, n)
+	for i := range result {
+		t := model.InitialState().Time.Add(time.Duration(i+1) * time.Second)
+		position := mat.NewVecDense(1, []float64{float64(i + 1)})
+		result[i] = NewMeasurementAtTime(t, model.NewPositionMeasurement(position, 0.1))
+	}
+
+	return result
+}
+
+// newNoisyTestMeasurements returns n noisy position measurements of a particle moving with
+// unit velocity, taken at irregular times.
+func newNoisyTestMeasurements(model *models.ConstantVelocityModel, n int) []*MeasurementAtTime {
+	r := rand.New(rand.NewSource(1))
+	start := model.InitialState().Time
+	t := start
+
+	result := make([]*MeasurementAtTime, n)
+	for i := range result {
+		t = t.Add(time.Duration((0.5 + r.Float64()) * float64(time.Second)))
+		position := mat.NewVecDense(1, []float64{t.Sub(start).Seconds() + 0.3*r.NormFloat64()})
+		result[i] = NewMeasurementAtTime(t, model.NewPositionMeasurement(position, 0.1))
+	}
+
+	return result
+}
+
+// newTestQueryTimes returns times before, between, at and after the given measurements.
+func newTestQueryTimes(measurements []*MeasurementAtTime) []time.Time {
+	last := measurements[len(measurements)-1].Time
+
+	result := []time.Time{last.Add(time.Second), measurements[0].Time.Add(-time.Millisecond)}
+	for i := 1; i < len(measurements); i += 3 {
+		previous := measurements[i-1].Time
+		result = append(result, measurements[i].Time, previous.Add(measurements[i].Time.Sub(previous)/2))
+	}
+
+	return result
+}
+
+func assertVecNear(t *testing.T, expected, actual mat.Vector, tolerance float64) {
+	t.Helper()
+
+	if expected.Len() != actual.Len() {
+		t.Fatalf("expected vector of length %d, got %d", expected.Len(), actual.Len())
+	}
+
+	for i := 0; i < expected.Len(); i++ {
+		if math.Abs(expected.AtVec(i)-actual.AtVec(i)) > tolerance {
+			t.Fatalf("expected %v, got %v", mat.Formatted(expected.T()), mat.Formatted(actual.T()))
+		}
+	}
+}
+
+func assertStatesNear(t *testing.T, expected, actual []models.State, tolerance float64) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d states, got %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		if !expected[i].Time.Equal(actual[i].Time) {
+			t.Fatalf("state %d: expected time %s, got %s", i, expected[i].Time, actual[i].Time)
+		}
+
+		assertVecNear(t, expected[i].State, actual[i].State, tolerance)
+		assertMatNear(t, expected[i].Covariance, actual[i].Covariance, tolerance)
+	}
+}
+
+func assertMatNear(t *testing.T, expected, actual mat.Matrix, tolerance float64) {
+	t.Helper()
+
+	if !mat.EqualApprox(expected, actual, tolerance) {
+		t.Fatalf("expected\n%v\ngot\n%v", mat.Formatted(expected), mat.Formatted(actual))
+	}
+}
+
+func TestPredictWithControl(t *testing.T) {
+	model := newTestModel()
+	filter := NewKalmanFilter(model)
+	t1 := model.InitialState().Time.Add(2 * time.Second)
+
+	err := filter.PredictWithControl(t1, mat.NewVecDense(2, []float64{1, 1}))
+	if err == nil {
+		t.Fatal("expected an error for a control input of the wrong length")
+	}
+
+	if !filter.Time().Equal(model.InitialState().Time) {
+		t.Fatalf("expected the filter to be unchanged, got time %s", filter.Time())
+	}
+
+	err = filter.PredictWithControl(t1, mat.NewVecDense(1, []float64{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A unit acceleration for two seconds from rest.
+	assertVecNear(t, mat.NewVecDense(2, []float64{2, 2}), filter.State(), 1e-12)
+}
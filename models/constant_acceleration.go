@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ConstantAccelerationModelConfig is used to set the variance of the process and
+// the variance of the first measurement.
+// It is assumed that the covariance of the state is a scaled identity matrix,
+// so that the variance of each component of the position, velocity and acceleration are identical.
+// Observation variances in this model are provided on a per-measurement basis.
+type ConstantAccelerationModelConfig struct {
+	InitialVariance float64
+	ProcessVariance float64
+}
+
+// ConstantAccelerationModel models a particle moving over time with state modelled by position,
+// velocity and acceleration.
+type ConstantAccelerationModel struct {
+	initialState State
+	dims         int
+	stateDims    int
+	cfg          ConstantAccelerationModelConfig
+}
+
+// NewConstantAccelerationModel initialises a constant acceleration model.
+func NewConstantAccelerationModel(initialTime time.Time, initialPosition mat.Vector, cfg ConstantAccelerationModelConfig) *ConstantAccelerationModel {
+	dims := initialPosition.Len()
+	stateDims := 3 * dims
+
+	initialCovariance := mat.NewDense(stateDims, stateDims, nil)
+	for i := 0; i < stateDims; i++ {
+		initialCovariance.Set(i, i, cfg.InitialVariance)
+	}
+
+	initialState := mat.NewVecDense(stateDims, nil)
+	for i := 0; i < dims; i++ {
+		initialState.SetVec(i, initialPosition.AtVec(i))
+	}
+
+	return &ConstantAccelerationModel{
+		dims:      dims,
+		stateDims: stateDims,
+		initialState: State{
+			Time:       initialTime,
+			State:      initialState,
+			Covariance: initialCovariance,
+		},
+		cfg: cfg,
+	}
+}
+
+// InitialState initializes the model.
+func (m *ConstantAccelerationModel) InitialState() State {
+	return m.initialState
+}
+
+// Transition returns the linear transformation that advances the model for the given time
+// step.
+func (m *ConstantAccelerationModel) Transition(dt time.Duration) mat.Matrix {
+	result := mat.NewDense(m.stateDims, m.stateDims, nil)
+	for i := 0; i < m.stateDims; i++ {
+		result.Set(i, i, 1.0)
+	}
+
+	dts := dt.Seconds()
+	for i := 0; i < m.dims; i++ {
+		result.Set(i, m.dims+i, dts)
+		result.Set(i, 2*m.dims+i, 0.5*dts*dts)
+		result.Set(m.dims+i, 2*m.dims+i, dts)
+	}
+
+	return result
+}
+
+// CovarianceTransition returns the covariance of the process noise for the given time step.
+// Note: As for the ConstantVelocityModel, this covariance is very simple.
+func (m *ConstantAccelerationModel) CovarianceTransition(dt time.Duration) mat.Matrix {
+	result := mat.NewDense(m.stateDims, m.stateDims, nil)
+	v := dt.Seconds() * m.cfg.ProcessVariance
+
+	for i := 0; i < m.stateDims; i++ {
+		result.Set(i, i, v)
+	}
+
+	return result
+}
+
+// NewPositionMeasurement provides a new measurement for fusing into the model state.
+// It is assumed the covariance of the measurement is a scaled identity matrix.
+func (m *ConstantAccelerationModel) NewPositionMeasurement(position mat.Vector, variance float64) *Measurement {
+	if position.Len() != m.dims {
+		panic(fmt.Sprintf("position vector has incorrect number of entries: %d (expected %d)", position.Len(), m.dims))
+	}
+
+	covariance := mat.NewDense(m.dims, m.dims, nil)
+	for i := 0; i < m.dims; i++ {
+		covariance.Set(i, i, variance)
+	}
+
+	observationModel := mat.NewDense(m.dims, m.stateDims, nil)
+	for i := 0; i < m.dims; i++ {
+		observationModel.Set(i, i, 1.0)
+	}
+
+	return &Measurement{
+		Value:            position,
+		Covariance:       covariance,
+		ObservationModel: observationModel,
+	}
+}
+
+// Position is a helper to read the position value from a state vector for this model.
+func (m *ConstantAccelerationModel) Position(state mat.Vector) mat.Vector {
+	return m.component(state, 0)
+}
+
+// Velocity is a helper to read the velocity value from a state vector for this model.
+func (m *ConstantAccelerationModel) Velocity(state mat.Vector) mat.Vector {
+	return m.component(state, 1)
+}
+
+// Acceleration is a helper to read the acceleration value from a state vector for this model.
+func (m *ConstantAccelerationModel) Acceleration(state mat.Vector) mat.Vector {
+	return m.component(state, 2)
+}
+
+// component reads the i'th block of entries of the state vector, each of which has one entry per axis.
+func (m *ConstantAccelerationModel) component(state mat.Vector, i int) mat.Vector {
+	if state.Len() != m.stateDims {
+		panic(fmt.Sprintf("state vector has incorrect number of entries: %d (expected %d)", state.Len(), m.stateDims))
+	}
+
+	result := mat.NewVecDense(m.dims, nil)
+	for j := 0; j < m.dims; j++ {
+		result.SetVec(j, state.AtVec(i*m.dims+j))
+	}
+
+	return result
+}
@@ -0,0 +1,3 @@
+package models
+
+var _ LinearModel = (*ConstantAccelerationModel)(nil)
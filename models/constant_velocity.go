@@ -15,8 +15,27 @@ import (
 type ConstantVelocityModelConfig struct {
 	InitialVariance float64
 	ProcessVariance float64
+
+	// ProcessNoise selects the model of the process noise, the zero value is ScaledIdentityNoise.
+	ProcessNoise ProcessNoiseModel
+	// SpectralDensities optionally sets the spectral density of the acceleration noise
+	// of each axis, for WhiteNoiseAcceleration. If nil, ProcessVariance is used for every axis.
+	SpectralDensities []float64
 }
 
+// ProcessNoiseModel selects the process noise of the ConstantVelocityModel.
+type ProcessNoiseModel int
+
+const (
+	// ScaledIdentityNoise adds independent noise of variance dt * ProcessVariance
+	// to each component of the position and velocity.
+	ScaledIdentityNoise ProcessNoiseModel = iota
+	// WhiteNoiseAcceleration models the acceleration along each axis as continuous white noise
+	// of spectral density q. Discretizing this gives the noise of the position and velocity
+	// of each axis as q [[dt^3/3, dt^2/2], [dt^2/2, dt]], which is consistent across time steps.
+	WhiteNoiseAcceleration
+)
+
 // ConstantVelocityModel models a particle moving over time with state modelled by position
 // and velocity.
 type ConstantVelocityModel struct {
@@ -31,6 +50,10 @@ func NewConstantVelocityModel(initialTime time.Time, initialPosition mat.Vector,
 	dims := initialPosition.Len()
 	stateDims := 2 * dims
 
+	if cfg.SpectralDensities != nil && len(cfg.SpectralDensities) != dims {
+		panic(fmt.Sprintf("incorrect number of spectral densities: %d (expected %d)", len(cfg.SpectralDensities), dims))
+	}
+
 	initialCovariance := mat.NewDense(stateDims, stateDims, nil)
 	for i := 0; i < stateDims; i++ {
 		initialCovariance.Set(i, i, cfg.InitialVariance)
@@ -75,9 +98,13 @@ func (m *ConstantVelocityModel) Transition(dt time.Duration) mat.Matrix {
 }
 
 // CovarianceTransition returns the covariance of the process noise for the given time step.
-// Note: This covariance is very simple, there are better ways to model the process noise
-// for constant velocity models.
+// Note: The default ScaledIdentityNoise is very simple, WhiteNoiseAcceleration
+// can be selected in the config for a better model of the process noise.
 func (m *ConstantVelocityModel) CovarianceTransition(dt time.Duration) mat.Matrix {
+	if m.cfg.ProcessNoise == WhiteNoiseAcceleration {
+		return m.whiteNoiseAccelerationCovariance(dt)
+	}
+
 	result := mat.NewDense(m.stateDims, m.stateDims, nil)
 	v := dt.Seconds() * m.cfg.ProcessVariance
 
@@ -88,6 +115,42 @@ func (m *ConstantVelocityModel) CovarianceTransition(dt time.Duration) mat.Matri
 	return result
 }
 
+// whiteNoiseAccelerationCovariance returns the process noise for continuous white noise acceleration,
+// which for each axis is q [[dt^3/3, dt^2/2], [dt^2/2, dt]], for the spectral density q of the axis.
+func (m *ConstantVelocityModel) whiteNoiseAccelerationCovariance(dt time.Duration) mat.Matrix {
+	result := mat.NewDense(m.stateDims, m.stateDims, nil)
+	dts := dt.Seconds()
+
+	for i := 0; i < m.dims; i++ {
+		q := m.cfg.ProcessVariance
+		if m.cfg.SpectralDensities != nil {
+			q = m.cfg.SpectralDensities[i]
+		}
+
+		result.Set(i, i, q*dts*dts*dts/3)
+		result.Set(i, m.dims+i, q*dts*dts/2)
+		result.Set(m.dims+i, i, q*dts*dts/2)
+		result.Set(m.dims+i, m.dims+i, q*dts)
+	}
+
+	return result
+}
+
+// ControlTransition returns the linear transformation that maps a constant acceleration,
+// applied over the given time step, into a change of position and velocity.
+// This allows commanded accelerations to be used as control inputs.
+func (m *ConstantVelocityModel) ControlTransition(dt time.Duration) mat.Matrix {
+	result := mat.NewDense(m.stateDims, m.dims, nil)
+
+	dts := dt.Seconds()
+	for i := 0; i < m.dims; i++ {
+		result.Set(i, i, 0.5*dts*dts)
+		result.Set(m.dims+i, i, dts)
+	}
+
+	return result
+}
+
 // NewPositionMeasurement provides a new measurement for fusing into the model state.
 // It is assumed the covariance of the measurement is a scaled identity matrix.
 func (m *ConstantVelocityModel) NewPositionMeasurement(position mat.Vector, variance float64) *Measurement {
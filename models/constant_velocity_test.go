@@ -1,3 +1,4 @@
 package models
 
 var _ LinearModel = (*ConstantVelocityModel)(nil)
+var _ ControlModel = (*ConstantVelocityModel)(nil)
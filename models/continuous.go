@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ContinuousLinearModel models a process with continuous-time linear dynamics
+// dx/dt = Ax + w, where w is white noise with diffusion matrix Qc.
+// The model is discretized exactly for each time step, so that time steps need not be uniform.
+type ContinuousLinearModel struct {
+	initialState State
+	dims         int
+	dynamics     mat.Matrix
+	diffusion    mat.Matrix
+}
+
+// NewContinuousLinearModel initialises a continuous linear model with the dynamics matrix A
+// and the diffusion matrix Qc.
+func NewContinuousLinearModel(initialState State, A, Qc mat.Matrix) *ContinuousLinearModel {
+	dims := initialState.State.Len()
+
+	if r, c := A.Dims(); r != dims || c != dims {
+		panic(fmt.Sprintf("dynamics matrix has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims))
+	}
+
+	if r, c := Qc.Dims(); r != dims || c != dims {
+		panic(fmt.Sprintf("diffusion matrix has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims))
+	}
+
+	return &ContinuousLinearModel{
+		initialState: initialState,
+		dims:         dims,
+		dynamics:     mat.DenseCopyOf(A),
+		diffusion:    mat.DenseCopyOf(Qc),
+	}
+}
+
+// InitialState initializes the model.
+func (m *ContinuousLinearModel) InitialState() State {
+	return m.initialState
+}
+
+// Transition returns the linear transformation that advances the model for the given time
+// step, exp(A dt).
+func (m *ContinuousLinearModel) Transition(dt time.Duration) mat.Matrix {
+	At := mat.NewDense(m.dims, m.dims, nil)
+	At.Scale(dt.Seconds(), m.dynamics)
+
+	result := mat.NewDense(m.dims, m.dims, nil)
+	result.Exp(At)
+
+	return result
+}
+
+// CovarianceTransition returns the covariance of the process noise for the given time step,
+// Q = integral of exp(As) Qc exp(As)^T for s from 0 to dt.
+// This is computed using Van Loan's method: for G = exp([[-A, Qc], [0, A^T]] dt),
+// the transition is F = G22^T and Q = F G12.
+func (m *ContinuousLinearModel) CovarianceTransition(dt time.Duration) mat.Matrix {
+	n := m.dims
+	dts := dt.Seconds()
+
+	M := mat.NewDense(2*n, 2*n, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			M.Set(i, j, -m.dynamics.At(i, j)*dts)
+			M.Set(i, n+j, m.diffusion.At(i, j)*dts)
+			M.Set(n+i, n+j, m.dynamics.At(j, i)*dts)
+		}
+	}
+
+	G := mat.NewDense(2*n, 2*n, nil)
+	G.Exp(M)
+
+	G12 := G.Slice(0, n, n, 2*n)
+	G22 := G.Slice(n, 2*n, n, 2*n)
+
+	Q := mat.NewDense(n, n, nil)
+	Q.Mul(G22.T(), G12)
+
+	// Remove any asymmetry due to rounding.
+	result := mat.NewDense(n, n, nil)
+	result.Add(Q, Q.T())
+	result.Scale(0.5, result)
+
+	return result
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+var _ LinearModel = (*ContinuousLinearModel)(nil)
+
+func TestContinuousLinearModelMatchesWhiteNoiseAcceleration(t *testing.T) {
+	const q = 0.3
+
+	expected := NewConstantVelocityModel(
+		time.Time{},
+		mat.NewVecDense(1, nil),
+		ConstantVelocityModelConfig{InitialVariance: 1, ProcessVariance: q, ProcessNoise: WhiteNoiseAcceleration},
+	)
+
+	actual := NewContinuousLinearModel(
+		expected.InitialState(),
+		mat.NewDense(2, 2, []float64{0, 1, 0, 0}),
+		mat.NewDense(2, 2, []float64{0, 0, 0, q}),
+	)
+
+	for _, dt := range []time.Duration{time.Millisecond, 500 * time.Millisecond, time.Second, 10 * time.Second} {
+		if e, a := expected.Transition(dt), actual.Transition(dt); !mat.EqualApprox(e, a, 1e-9) {
+			t.Errorf("dt %s: expected transition %v, got %v", dt, mat.Formatted(e), mat.Formatted(a))
+		}
+
+		if e, a := expected.CovarianceTransition(dt), actual.CovarianceTransition(dt); !mat.EqualApprox(e, a, 1e-9) {
+			t.Errorf("dt %s: expected process noise %v, got %v", dt, mat.Formatted(e), mat.Formatted(a))
+		}
+	}
+}
@@ -12,10 +12,66 @@ type State struct {
 	Covariance mat.Matrix
 }
 
+// Measurement is a value observed by a sensor, along with the covariance of the
+// observation noise and a description of how the value relates to the hidden state.
+// Linear measurements provide an ObservationModel matrix H, so that the expected
+// value of the measurement is Hx.
+// Nonlinear measurements instead provide an ObservationFunction h(x) along with
+// its ObservationJacobian, in which case ObservationModel is ignored.
+// The ObservationJacobian may be omitted when the measurement is only used with
+// filters that do not linearize, such as the UnscentedKalmanFilter.
+// Filters that linearize return an error for measurements without a Jacobian.
 type Measurement struct {
 	Covariance       mat.Matrix
 	Value            mat.Vector
 	ObservationModel mat.Matrix
+
+	ObservationFunction func(state mat.Vector) mat.Vector
+	ObservationJacobian func(state mat.Vector) mat.Matrix
+}
+
+// NewNonlinearMeasurement returns a measurement with the given nonlinear observation function h(x)
+// and its Jacobian.
+func NewNonlinearMeasurement(
+	value mat.Vector,
+	covariance mat.Matrix,
+	observationFunction func(state mat.Vector) mat.Vector,
+	observationJacobian func(state mat.Vector) mat.Matrix,
+) *Measurement {
+	return &Measurement{
+		Value:               value,
+		Covariance:          covariance,
+		ObservationFunction: observationFunction,
+		ObservationJacobian: observationJacobian,
+	}
+}
+
+// IsNonlinear returns true if the measurement provides an observation function.
+func (m *Measurement) IsNonlinear() bool {
+	return m.ObservationFunction != nil
+}
+
+// Observe returns the expected value of the measurement for the given state.
+func (m *Measurement) Observe(state mat.Vector) mat.Vector {
+	if m.IsNonlinear() {
+		return m.ObservationFunction(state)
+	}
+
+	rows, _ := m.ObservationModel.Dims()
+	result := mat.NewVecDense(rows, nil)
+	result.MulVec(m.ObservationModel, state)
+
+	return result
+}
+
+// Jacobian returns the linearization of the observation about the given state.
+// For linear measurements, this is simply the ObservationModel.
+func (m *Measurement) Jacobian(state mat.Vector) mat.Matrix {
+	if m.IsNonlinear() {
+		return m.ObservationJacobian(state)
+	}
+
+	return m.ObservationModel
 }
 
 // LinearModel is used to initialize hidden states in the model and
@@ -26,3 +82,49 @@ type LinearModel interface {
 	Transition(dt time.Duration) mat.Matrix
 	CovarianceTransition(dt time.Duration) mat.Matrix
 }
+
+// ControlModel is a LinearModel that also accepts known control inputs u,
+// such as commanded accelerations or odometry. The control input enters the
+// transition of the state as x' = Fx + Bu, where B is given by ControlTransition.
+type ControlModel interface {
+	LinearModel
+	ControlTransition(dt time.Duration) mat.Matrix
+}
+
+// PropagationModel is used to initialize hidden states in the model and
+// to propagate them through possibly nonlinear dynamics.
+// This is sufficient for the UnscentedKalmanFilter, which does not require derivatives.
+type PropagationModel interface {
+	InitialState() State
+	Propagate(state mat.Vector, dt time.Duration) mat.Vector
+	CovarianceTransition(dt time.Duration) mat.Matrix
+}
+
+// NonlinearModel is a PropagationModel that also provides the Jacobian of its
+// propagation function.
+// The Jacobian is used by the ExtendedKalmanFilter to propagate the covariance of the state.
+type NonlinearModel interface {
+	PropagationModel
+	PropagationJacobian(state mat.Vector, dt time.Duration) mat.Matrix
+}
+
+// AsNonlinear wraps a LinearModel so that it may be used with filters accepting
+// nonlinear models.
+func AsNonlinear(model LinearModel) NonlinearModel {
+	return &linearModelAdapter{LinearModel: model}
+}
+
+type linearModelAdapter struct {
+	LinearModel
+}
+
+func (m *linearModelAdapter) Propagate(state mat.Vector, dt time.Duration) mat.Vector {
+	result := mat.NewVecDense(state.Len(), nil)
+	result.MulVec(m.Transition(dt), state)
+
+	return result
+}
+
+func (m *linearModelAdapter) PropagationJacobian(state mat.Vector, dt time.Duration) mat.Matrix {
+	return m.Transition(dt)
+}
@@ -0,0 +1,3 @@
+package models
+
+var _ NonlinearModel = (*linearModelAdapter)(nil)
@@ -0,0 +1,565 @@
+package models
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// stateData is the serialized form of a State.
+type stateData struct {
+	Time       time.Time   `json:"time"`
+	State      []float64   `json:"state"`
+	Covariance [][]float64 `json:"covariance"`
+}
+
+// measurementData is the serialized form of a Measurement.
+type measurementData struct {
+	Value            []float64   `json:"value"`
+	Covariance       [][]float64 `json:"covariance"`
+	ObservationModel [][]float64 `json:"observation_model"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *State) UnmarshalJSON(b []byte) error {
+	var d stateData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return s.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (s State) MarshalBinary() ([]byte, error) {
+	return gobEncode(s.data())
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *State) UnmarshalBinary(b []byte) error {
+	var d stateData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return s.setData(d)
+}
+
+func (s State) data() stateData {
+	return stateData{
+		Time:       s.Time,
+		State:      vectorData(s.State),
+		Covariance: matrixData(s.Covariance),
+	}
+}
+
+func (s *State) setData(d stateData) error {
+	covariance, err := newMatrix(d.Covariance)
+	if err != nil {
+		return fmt.Errorf("invalid covariance: %s", err)
+	}
+
+	s.Time = d.Time
+	s.State = newVector(d.State)
+	s.Covariance = covariance
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+// Only linear measurements can be serialized, since observation functions can't be.
+func (m Measurement) MarshalJSON() ([]byte, error) {
+	d, err := m.data()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(d)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *Measurement) UnmarshalJSON(b []byte) error {
+	var d measurementData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+// Only linear measurements can be serialized, since observation functions can't be.
+func (m Measurement) MarshalBinary() ([]byte, error) {
+	d, err := m.data()
+	if err != nil {
+		return nil, err
+	}
+
+	return gobEncode(d)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *Measurement) UnmarshalBinary(b []byte) error {
+	var d measurementData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+func (m Measurement) data() (measurementData, error) {
+	if m.IsNonlinear() {
+		return measurementData{}, fmt.Errorf("can't serialize a nonlinear measurement")
+	}
+
+	return measurementData{
+		Value:            vectorData(m.Value),
+		Covariance:       matrixData(m.Covariance),
+		ObservationModel: matrixData(m.ObservationModel),
+	}, nil
+}
+
+func (m *Measurement) setData(d measurementData) error {
+	covariance, err := newMatrix(d.Covariance)
+	if err != nil {
+		return fmt.Errorf("invalid covariance: %s", err)
+	}
+
+	observationModel, err := newMatrix(d.ObservationModel)
+	if err != nil {
+		return fmt.Errorf("invalid observation model: %s", err)
+	}
+
+	value := newVector(d.Value)
+	if value == nil {
+		return fmt.Errorf("missing value")
+	}
+
+	n := value.Len()
+
+	if covariance == nil {
+		return fmt.Errorf("missing covariance")
+	}
+	if r, c := covariance.Dims(); r != n || c != n {
+		return fmt.Errorf("covariance has incorrect size: %dx%d (expected %dx%d)", r, c, n, n)
+	}
+
+	if observationModel == nil {
+		return fmt.Errorf("missing observation model")
+	}
+	if r, _ := observationModel.Dims(); r != n {
+		return fmt.Errorf("observation model has incorrect number of rows: %d (expected %d)", r, n)
+	}
+
+	*m = Measurement{
+		Value:            value,
+		Covariance:       covariance,
+		ObservationModel: observationModel,
+	}
+
+	return nil
+}
+
+// brownianModelData is the serialized form of a BrownianModel.
+type brownianModelData struct {
+	InitialState State               `json:"initial_state"`
+	Config       BrownianModelConfig `json:"config"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *BrownianModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *BrownianModel) UnmarshalJSON(b []byte) error {
+	var d brownianModelData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (m *BrownianModel) MarshalBinary() ([]byte, error) {
+	return gobEncode(m.data())
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *BrownianModel) UnmarshalBinary(b []byte) error {
+	var d brownianModelData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+func (m *BrownianModel) data() brownianModelData {
+	return brownianModelData{
+		InitialState: m.initialState,
+		Config:       m.cfg,
+	}
+}
+
+func (m *BrownianModel) setData(d brownianModelData) error {
+	if d.InitialState.State == nil {
+		return fmt.Errorf("missing initial state")
+	}
+
+	if err := checkCovariance(d.InitialState, d.InitialState.State.Len()); err != nil {
+		return err
+	}
+
+	*m = *NewBrownianModel(d.InitialState.Time, d.InitialState.State, d.Config)
+	m.initialState = d.InitialState
+
+	return nil
+}
+
+// constantVelocityModelData is the serialized form of a ConstantVelocityModel.
+type constantVelocityModelData struct {
+	InitialState State                       `json:"initial_state"`
+	Config       ConstantVelocityModelConfig `json:"config"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *ConstantVelocityModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *ConstantVelocityModel) UnmarshalJSON(b []byte) error {
+	var d constantVelocityModelData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (m *ConstantVelocityModel) MarshalBinary() ([]byte, error) {
+	return gobEncode(m.data())
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *ConstantVelocityModel) UnmarshalBinary(b []byte) error {
+	var d constantVelocityModelData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+func (m *ConstantVelocityModel) data() constantVelocityModelData {
+	return constantVelocityModelData{
+		InitialState: m.initialState,
+		Config:       m.cfg,
+	}
+}
+
+func (m *ConstantVelocityModel) setData(d constantVelocityModelData) error {
+	if d.InitialState.State == nil {
+		return fmt.Errorf("missing initial state")
+	}
+
+	stateDims := d.InitialState.State.Len()
+	if stateDims%2 != 0 {
+		return fmt.Errorf("state has %d entries, expected a position and velocity for each axis", stateDims)
+	}
+
+	if err := checkCovariance(d.InitialState, stateDims); err != nil {
+		return err
+	}
+
+	dims := stateDims / 2
+	if d.Config.SpectralDensities != nil && len(d.Config.SpectralDensities) != dims {
+		return fmt.Errorf("incorrect number of spectral densities: %d (expected %d)", len(d.Config.SpectralDensities), dims)
+	}
+
+	position := mat.NewVecDense(dims, nil)
+	for i := 0; i < dims; i++ {
+		position.SetVec(i, d.InitialState.State.AtVec(i))
+	}
+
+	*m = *NewConstantVelocityModel(d.InitialState.Time, position, d.Config)
+	m.initialState = d.InitialState
+
+	return nil
+}
+
+// constantAccelerationModelData is the serialized form of a ConstantAccelerationModel.
+type constantAccelerationModelData struct {
+	InitialState State                           `json:"initial_state"`
+	Config       ConstantAccelerationModelConfig `json:"config"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *ConstantAccelerationModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *ConstantAccelerationModel) UnmarshalJSON(b []byte) error {
+	var d constantAccelerationModelData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (m *ConstantAccelerationModel) MarshalBinary() ([]byte, error) {
+	return gobEncode(m.data())
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *ConstantAccelerationModel) UnmarshalBinary(b []byte) error {
+	var d constantAccelerationModelData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+func (m *ConstantAccelerationModel) data() constantAccelerationModelData {
+	return constantAccelerationModelData{
+		InitialState: m.initialState,
+		Config:       m.cfg,
+	}
+}
+
+func (m *ConstantAccelerationModel) setData(d constantAccelerationModelData) error {
+	if d.InitialState.State == nil {
+		return fmt.Errorf("missing initial state")
+	}
+
+	stateDims := d.InitialState.State.Len()
+	if stateDims%3 != 0 {
+		return fmt.Errorf("state has %d entries, expected a position, velocity and acceleration for each axis", stateDims)
+	}
+
+	if err := checkCovariance(d.InitialState, stateDims); err != nil {
+		return err
+	}
+
+	dims := stateDims / 3
+
+	position := mat.NewVecDense(dims, nil)
+	for i := 0; i < dims; i++ {
+		position.SetVec(i, d.InitialState.State.AtVec(i))
+	}
+
+	*m = *NewConstantAccelerationModel(d.InitialState.Time, position, d.Config)
+	m.initialState = d.InitialState
+
+	return nil
+}
+
+// continuousLinearModelData is the serialized form of a ContinuousLinearModel.
+type continuousLinearModelData struct {
+	InitialState State       `json:"initial_state"`
+	Dynamics     [][]float64 `json:"dynamics"`
+	Diffusion    [][]float64 `json:"diffusion"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *ContinuousLinearModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *ContinuousLinearModel) UnmarshalJSON(b []byte) error {
+	var d continuousLinearModelData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (m *ContinuousLinearModel) MarshalBinary() ([]byte, error) {
+	return gobEncode(m.data())
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *ContinuousLinearModel) UnmarshalBinary(b []byte) error {
+	var d continuousLinearModelData
+	if err := gobDecode(b, &d); err != nil {
+		return err
+	}
+
+	return m.setData(d)
+}
+
+func (m *ContinuousLinearModel) data() continuousLinearModelData {
+	return continuousLinearModelData{
+		InitialState: m.initialState,
+		Dynamics:     matrixData(m.dynamics),
+		Diffusion:    matrixData(m.diffusion),
+	}
+}
+
+func (m *ContinuousLinearModel) setData(d continuousLinearModelData) error {
+	if d.InitialState.State == nil {
+		return fmt.Errorf("missing initial state")
+	}
+
+	dynamics, err := newMatrix(d.Dynamics)
+	if err != nil {
+		return fmt.Errorf("invalid dynamics: %s", err)
+	}
+
+	diffusion, err := newMatrix(d.Diffusion)
+	if err != nil {
+		return fmt.Errorf("invalid diffusion: %s", err)
+	}
+
+	dims := d.InitialState.State.Len()
+
+	if err := checkCovariance(d.InitialState, dims); err != nil {
+		return err
+	}
+
+	if dynamics == nil {
+		return fmt.Errorf("missing dynamics")
+	}
+	if r, c := dynamics.Dims(); r != dims || c != dims {
+		return fmt.Errorf("dynamics has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims)
+	}
+
+	if diffusion == nil {
+		return fmt.Errorf("missing diffusion")
+	}
+	if r, c := diffusion.Dims(); r != dims || c != dims {
+		return fmt.Errorf("diffusion has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims)
+	}
+
+	*m = *NewContinuousLinearModel(d.InitialState, dynamics, diffusion)
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *SimpleModel) MarshalJSON() ([]byte, error) {
+	return s.model.MarshalJSON()
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *SimpleModel) UnmarshalJSON(b []byte) error {
+	s.model = &BrownianModel{}
+	return s.model.UnmarshalJSON(b)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (s *SimpleModel) MarshalBinary() ([]byte, error) {
+	return s.model.MarshalBinary()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *SimpleModel) UnmarshalBinary(b []byte) error {
+	s.model = &BrownianModel{}
+	return s.model.UnmarshalBinary(b)
+}
+
+// checkCovariance returns an error if the covariance of the state is missing,
+// or isn't of the given size.
+func checkCovariance(s State, dims int) error {
+	if s.Covariance == nil {
+		return fmt.Errorf("missing initial covariance")
+	}
+
+	if r, c := s.Covariance.Dims(); r != dims || c != dims {
+		return fmt.Errorf("initial covariance has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims)
+	}
+
+	return nil
+}
+
+func vectorData(v mat.Vector) []float64 {
+	if v == nil {
+		return nil
+	}
+
+	result := make([]float64, v.Len())
+	for i := range result {
+		result[i] = v.AtVec(i)
+	}
+
+	return result
+}
+
+func matrixData(m mat.Matrix) [][]float64 {
+	if m == nil {
+		return nil
+	}
+
+	r, c := m.Dims()
+	result := make([][]float64, r)
+	for i := range result {
+		result[i] = make([]float64, c)
+		for j := range result[i] {
+			result[i][j] = m.At(i, j)
+		}
+	}
+
+	return result
+}
+
+func newVector(data []float64) mat.Vector {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return mat.NewVecDense(len(data), append([]float64(nil), data...))
+}
+
+func newMatrix(data [][]float64) (mat.Matrix, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	r, c := len(data), len(data[0])
+	if c == 0 {
+		return nil, fmt.Errorf("matrix has no columns")
+	}
+
+	result := mat.NewDense(r, c, nil)
+	for i, row := range data {
+		if len(row) != c {
+			return nil, fmt.Errorf("row %d has %d entries (expected %d)", i, len(row), c)
+		}
+		result.SetRow(i, row)
+	}
+
+	return result, nil
+}
+
+func gobEncode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func gobDecode(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestConstantVelocityModelRoundTrip(t *testing.T) {
+	model := NewConstantVelocityModel(
+		time.Unix(100, 0).UTC(),
+		mat.NewVecDense(2, []float64{1, 2}),
+		ConstantVelocityModelConfig{
+			InitialVariance:   1,
+			ProcessVariance:   0.1,
+			ProcessNoise:      WhiteNoiseAcceleration,
+			SpectralDensities: []float64{0.2, 0.5},
+		},
+	)
+
+	b, err := json.Marshal(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ConstantVelocityModel
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := model.CovarianceTransition(time.Second)
+	if actual := decoded.CovarianceTransition(time.Second); !mat.Equal(expected, actual) {
+		t.Errorf("expected process noise %v, got %v", mat.Formatted(expected), mat.Formatted(actual))
+	}
+}
+
+func TestModelInvalidPayloadIsAnError(t *testing.T) {
+	type decoder interface {
+		UnmarshalJSON(b []byte) error
+	}
+
+	cases := []struct {
+		name    string
+		model   func() decoder
+		payload string
+	}{
+		{
+			name:    "brownian missing covariance",
+			model:   func() decoder { return &BrownianModel{} },
+			payload: `{"initial_state": {"state": [1, 2]}, "config": {}}`,
+		},
+		{
+			name:    "brownian covariance size",
+			model:   func() decoder { return &BrownianModel{} },
+			payload: `{"initial_state": {"state": [1, 2], "covariance": [[1]]}, "config": {}}`,
+		},
+		{
+			name:    "simple missing covariance",
+			model:   func() decoder { return &SimpleModel{} },
+			payload: `{"initial_state": {"state": [1]}, "config": {}}`,
+		},
+		{
+			name:    "constant velocity spectral densities",
+			model:   func() decoder { return &ConstantVelocityModel{} },
+			payload: `{"initial_state": {"state": [0, 0], "covariance": [[1, 0], [0, 1]]}, "config": {"SpectralDensities": [1, 2]}}`,
+		},
+		{
+			name:    "constant velocity state length",
+			model:   func() decoder { return &ConstantVelocityModel{} },
+			payload: `{"initial_state": {"state": [0, 0, 0], "covariance": [[1, 0, 0], [0, 1, 0], [0, 0, 1]]}, "config": {}}`,
+		},
+		{
+			name:    "constant velocity missing covariance",
+			model:   func() decoder { return &ConstantVelocityModel{} },
+			payload: `{"initial_state": {"state": [0, 0]}, "config": {}}`,
+		},
+		{
+			name:    "constant acceleration state length",
+			model:   func() decoder { return &ConstantAccelerationModel{} },
+			payload: `{"initial_state": {"state": [0, 0], "covariance": [[1, 0], [0, 1]]}, "config": {}}`,
+		},
+		{
+			name:    "constant acceleration missing covariance",
+			model:   func() decoder { return &ConstantAccelerationModel{} },
+			payload: `{"initial_state": {"state": [0, 0, 0]}, "config": {}}`,
+		},
+		{
+			name:    "continuous missing covariance",
+			model:   func() decoder { return &ContinuousLinearModel{} },
+			payload: `{"initial_state": {"state": [0]}, "dynamics": [[0]], "diffusion": [[1]]}`,
+		},
+		{
+			name:    "continuous dynamics size",
+			model:   func() decoder { return &ContinuousLinearModel{} },
+			payload: `{"initial_state": {"state": [0], "covariance": [[1]]}, "dynamics": [[0, 1]], "diffusion": [[1]]}`,
+		},
+		{
+			name:    "continuous missing diffusion",
+			model:   func() decoder { return &ContinuousLinearModel{} },
+			payload: `{"initial_state": {"state": [0], "covariance": [[1]]}, "dynamics": [[0]]}`,
+		},
+	}
+
+	for _, c := range cases {
+		if err := json.Unmarshal([]byte(c.payload), c.model()); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
+
+func TestConstantVelocityModelInvalidBinaryIsAnError(t *testing.T) {
+	b, err := gobEncode(constantVelocityModelData{
+		InitialState: State{
+			State:      mat.NewVecDense(2, nil),
+			Covariance: mat.NewDense(2, 2, []float64{1, 0, 0, 1}),
+		},
+		Config: ConstantVelocityModelConfig{SpectralDensities: []float64{1, 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var model ConstantVelocityModel
+	if err := model.UnmarshalBinary(b); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestMeasurementInvalidPayloadIsAnError(t *testing.T) {
+	payloads := map[string]string{
+		"missing value":             `{"covariance": [[1]], "observation_model": [[1, 0]]}`,
+		"missing covariance":        `{"value": [1], "observation_model": [[1, 0]]}`,
+		"missing observation model": `{"value": [1], "covariance": [[1]]}`,
+		"covariance size":           `{"value": [1], "covariance": [[1, 0], [0, 1]], "observation_model": [[1, 0]]}`,
+		"observation model size":    `{"value": [1], "covariance": [[1]], "observation_model": [[1, 0], [0, 1]]}`,
+	}
+
+	for name, payload := range payloads {
+		var m Measurement
+		if err := json.Unmarshal([]byte(payload), &m); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
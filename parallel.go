@@ -0,0 +1,552 @@
+package kalman
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// The parallel smoother follows Särkkä and García-Fernández, "Temporal Parallelization of
+// Bayesian Smoothers", 2021. Each step of the filter and of the smoother is expressed as an
+// element of an associative operation, so that all steps can be computed by a parallel scan.
+
+// scanElement is an element of an associative operation.
+type scanElement interface {
+	// combine returns the element for the steps of the receiver followed by those of next.
+	combine(next scanElement) (scanElement, error)
+}
+
+// computeForwardsStateChangesParallel computes the same state changes as the regular KalmanFilter,
+// using a parallel scan over the filtering elements of the measurements.
+func (kf *KalmanSmoother) computeForwardsStateChangesParallel(measurements []*MeasurementAtTime) ([]kalmanStateChange, error) {
+	if kf.updateConfig.Gate != nil || kf.updateConfig.Robust != nil {
+		return nil, fmt.Errorf("parallel smoothing doesn't support gates or robust updates")
+	}
+
+	n := len(measurements)
+	initial := kf.model.InitialState()
+	dims := initial.State.Len()
+
+	result := make([]kalmanStateChange, n)
+	elements := make([]scanElement, n)
+
+	err := parallelFor(n, func(i int) error {
+		m := measurements[i]
+		if m.IsNonlinear() {
+			return fmt.Errorf("parallel smoothing doesn't support nonlinear measurements, found at index %d", i)
+		}
+
+		err := checkMeasurement(&m.Measurement, initial.State)
+		if err != nil {
+			return atIndex(err, i)
+		}
+
+		previous := initial.Time
+		if i > 0 {
+			previous = measurements[i-1].Time
+		}
+		dt := m.Time.Sub(previous)
+
+		result[i] = kalmanStateChange{
+			time:            m.Time,
+			modelTransition: mat.DenseCopyOf(kf.model.Transition(dt)),
+			processNoise:    mat.DenseCopyOf(kf.model.CovarianceTransition(dt)),
+			measurement:     &m.Measurement,
+		}
+
+		var element *filteringElement
+		if i == 0 {
+			element, err = newInitialFilteringElement(initial, &result[i])
+		} else {
+			element, err = newFilteringElement(&result[i])
+		}
+		if err != nil {
+			return fmt.Errorf("measurement at index %d: %s", i, err)
+		}
+
+		elements[i] = element
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scan(elements, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = parallelFor(n, func(i int) error {
+		stateChange := &result[i]
+
+		filtered := elements[i].(*filteringElement)
+		stateChange.APoseterioriState = filtered.b
+		stateChange.aPosterioriCovariance = filtered.C
+
+		x, P := initial.State, initial.Covariance
+		if i > 0 {
+			previous := elements[i-1].(*filteringElement)
+			x, P = previous.b, previous.C
+		}
+
+		F := stateChange.modelTransition
+
+		aPrioriState := mat.NewVecDense(dims, nil)
+		aPrioriState.MulVec(F, x)
+
+		aPrioriCovariance := mat.NewDense(dims, dims, nil)
+		aPrioriCovariance.Product(F, P, F.T())
+		aPrioriCovariance.Add(aPrioriCovariance, stateChange.processNoise)
+
+		stateChange.aPrioriState = aPrioriState
+		stateChange.aPrioriCovariance = aPrioriCovariance
+
+		m := stateChange.measurement
+		preFitResidual := mat.NewVecDense(m.Value.Len(), nil)
+		preFitResidual.MulVec(m.ObservationModel, aPrioriState)
+		preFitResidual.SubVec(m.Value, preFitResidual)
+
+		S, nis, err := innovation(aPrioriCovariance, m.ObservationModel, m.Covariance, preFitResidual)
+		if err != nil {
+			return fmt.Errorf("measurement at index %d: %s", i, err)
+		}
+
+		stateChange.logLikelihood = logLikelihood(S, nis)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// smoothParallel computes the Rauch–Tung–Striebel backwards pass using a parallel scan
+// over the smoothing elements of the state changes.
+func smoothParallel(ss []kalmanStateChange) (*backwardsPass, error) {
+	n := len(ss)
+
+	elements := make([]scanElement, n)
+	err := parallelFor(n, func(i int) error {
+		if i == n-1 {
+			elements[i] = &smoothingElement{
+				E: mat.NewDense(ss[i].aPrioriState.Len(), ss[i].aPrioriState.Len(), nil),
+				g: ss[i].APoseterioriState,
+				L: ss[i].aPosterioriCovariance,
+			}
+			return nil
+		}
+
+		element, err := newSmoothingElement(&ss[i], &ss[i+1])
+		if err != nil {
+			return &SingularCovarianceError{Index: i + 1, Err: err}
+		}
+
+		elements[i] = element
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gains := make([]mat.Matrix, n-1)
+	for i := range gains {
+		gains[i] = elements[i].(*smoothingElement).E
+	}
+
+	err = scan(elements, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &backwardsPass{
+		states:           make([]models.State, n),
+		gains:            gains,
+		crossCovariances: make([]mat.Matrix, n-1),
+	}
+
+	err = parallelFor(n, func(i int) error {
+		smoothed := elements[i].(*smoothingElement)
+		result.states[i] = models.State{
+			Time:       ss[i].time,
+			State:      smoothed.g,
+			Covariance: smoothed.L,
+		}
+
+		if i < n-1 {
+			next := elements[i+1].(*smoothingElement)
+			dims := next.g.Len()
+			crossCovariance := mat.NewDense(dims, dims, nil)
+			crossCovariance.Mul(next.L, gains[i].T())
+			result.crossCovariances[i] = crossCovariance
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// filteringElement describes the distribution of the state at the end of a range of steps,
+// conditioned on the measurements in that range, as a function of the state before the range:
+// x ~ N(Ax + b, C). The information about the state before the range provided by the
+// measurements in the range is J, η.
+type filteringElement struct {
+	A   *mat.Dense
+	b   *mat.VecDense
+	C   *mat.Dense
+	eta *mat.VecDense
+	J   *mat.Dense
+}
+
+// newInitialFilteringElement returns the element for the first step, which fuses
+// the first measurement with the initial state, and so doesn't depend on any earlier state.
+func newInitialFilteringElement(initial models.State, stateChange *kalmanStateChange) (*filteringElement, error) {
+	dims := initial.State.Len()
+	F := stateChange.modelTransition
+	m := stateChange.measurement
+
+	x := mat.NewVecDense(dims, nil)
+	x.MulVec(F, initial.State)
+
+	P := mat.NewDense(dims, dims, nil)
+	P.Product(F, initial.Covariance, F.T())
+	P.Add(P, stateChange.processNoise)
+
+	p, err := measurementUpdate(x, P, m, UpdateConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &filteringElement{
+		A:   mat.NewDense(dims, dims, nil),
+		b:   p.state,
+		C:   p.covariance,
+		eta: mat.NewVecDense(dims, nil),
+		J:   mat.NewDense(dims, dims, nil),
+	}, nil
+}
+
+// newFilteringElement returns the element for a step after the first.
+func newFilteringElement(stateChange *kalmanStateChange) (*filteringElement, error) {
+	F := stateChange.modelTransition
+	Q := stateChange.processNoise
+	m := stateChange.measurement
+	H := m.ObservationModel
+
+	dims, _ := F.Dims()
+	measurementDims := m.Value.Len()
+
+	// S = HQH^T + R
+	S := mat.NewDense(measurementDims, measurementDims, nil)
+	S.Product(H, Q, H.T())
+	S.Add(S, m.Covariance)
+
+	// K = QH^T S^-1, computed as K^T = S^-1 HQ.
+	HQ := mat.NewDense(measurementDims, dims, nil)
+	HQ.Mul(H, Q)
+
+	gainT := mat.NewDense(measurementDims, dims, nil)
+	err := gainT.Solve(S, HQ)
+	if err != nil {
+		return nil, fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	// I - KH
+	IKH := mat.NewDense(dims, dims, nil)
+	IKH.Mul(gainT.T(), H)
+	IKH.Sub(eye(dims), IKH)
+
+	A := mat.NewDense(dims, dims, nil)
+	A.Mul(IKH, F)
+
+	b := mat.NewVecDense(dims, nil)
+	b.MulVec(gainT.T(), m.Value)
+
+	C := mat.NewDense(dims, dims, nil)
+	C.Mul(IKH, Q)
+
+	// HF, S^-1 HF and S^-1 z give η = (HF)^T S^-1 z and J = (HF)^T S^-1 HF.
+	HF := mat.NewDense(measurementDims, dims, nil)
+	HF.Mul(H, F)
+
+	SInvHF := mat.NewDense(measurementDims, dims, nil)
+	err = SInvHF.Solve(S, HF)
+	if err != nil {
+		return nil, fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	SInvz := mat.NewVecDense(measurementDims, nil)
+	err = SInvz.SolveVec(S, m.Value)
+	if err != nil {
+		return nil, fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	eta := mat.NewVecDense(dims, nil)
+	eta.MulVec(HF.T(), SInvz)
+
+	J := mat.NewDense(dims, dims, nil)
+	J.Mul(HF.T(), SInvHF)
+
+	return &filteringElement{A: A, b: b, C: C, eta: eta, J: J}, nil
+}
+
+func (e *filteringElement) combine(next scanElement) (scanElement, error) {
+	n := next.(*filteringElement)
+	dims := e.b.Len()
+
+	// M = A_j (I + C_i J_j)^-1
+	IpCJ := mat.NewDense(dims, dims, nil)
+	IpCJ.Mul(e.C, n.J)
+	IpCJ.Add(eye(dims), IpCJ)
+
+	MT := mat.NewDense(dims, dims, nil)
+	err := MT.Solve(IpCJ.T(), n.A.T())
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine filtering elements: %s", err)
+	}
+	M := MT.T()
+
+	// N = A_i^T (I + J_j C_i)^-1
+	IpJC := mat.NewDense(dims, dims, nil)
+	IpJC.Mul(n.J, e.C)
+	IpJC.Add(eye(dims), IpJC)
+
+	NT := mat.NewDense(dims, dims, nil)
+	err = NT.Solve(IpJC.T(), e.A)
+	if err != nil {
+		return nil, fmt.Errorf("failed to combine filtering elements: %s", err)
+	}
+	N := NT.T()
+
+	A := mat.NewDense(dims, dims, nil)
+	A.Mul(M, e.A)
+
+	// b = M (b_i + C_i η_j) + b_j
+	b := mat.NewVecDense(dims, nil)
+	b.MulVec(e.C, n.eta)
+	b.AddVec(e.b, b)
+	b.MulVec(M, b)
+	b.AddVec(b, n.b)
+
+	// C = M C_i A_j^T + C_j
+	C := mat.NewDense(dims, dims, nil)
+	C.Product(M, e.C, n.A.T())
+	C.Add(C, n.C)
+
+	// η = N (η_j - J_j b_i) + η_i
+	eta := mat.NewVecDense(dims, nil)
+	eta.MulVec(n.J, e.b)
+	eta.SubVec(n.eta, eta)
+	eta.MulVec(N, eta)
+	eta.AddVec(eta, e.eta)
+
+	// J = N J_j A_i + J_i
+	J := mat.NewDense(dims, dims, nil)
+	J.Product(N, n.J, e.A)
+	J.Add(J, e.J)
+
+	return &filteringElement{A: A, b: b, C: C, eta: eta, J: J}, nil
+}
+
+// smoothingElement describes the distribution of the state at the start of a range of steps,
+// conditioned on all measurements, as a function of the smoothed state after the range:
+// x ~ N(Ex + g, L).
+type smoothingElement struct {
+	E *mat.Dense
+	g mat.Vector
+	L mat.Matrix
+}
+
+// newSmoothingElement returns the element for the step of the given state change,
+// which is followed by the step of next.
+func newSmoothingElement(stateChange, next *kalmanStateChange) (*smoothingElement, error) {
+	dims := stateChange.aPrioriState.Len()
+
+	aPrioriCovarianceInv := mat.NewDense(dims, dims, nil)
+	err := aPrioriCovarianceInv.Inverse(next.aPrioriCovariance)
+	if err != nil {
+		return nil, err
+	}
+
+	// E = P_{k|k} F_{k+1}^T P_{k+1|k}^-1
+	E := mat.NewDense(dims, dims, nil)
+	E.Product(stateChange.aPosterioriCovariance, next.modelTransition.T(), aPrioriCovarianceInv)
+
+	// g = x_{k|k} - E x_{k+1|k}
+	g := mat.NewVecDense(dims, nil)
+	g.MulVec(E, next.aPrioriState)
+	g.SubVec(stateChange.APoseterioriState, g)
+
+	// L = P_{k|k} - E P_{k+1|k} E^T
+	L := mat.NewDense(dims, dims, nil)
+	L.Product(E, next.aPrioriCovariance, E.T())
+	L.Sub(stateChange.aPosterioriCovariance, L)
+
+	return &smoothingElement{E: E, g: g, L: L}, nil
+}
+
+func (e *smoothingElement) combine(next scanElement) (scanElement, error) {
+	n := next.(*smoothingElement)
+	dims := e.g.Len()
+
+	E := mat.NewDense(dims, dims, nil)
+	E.Mul(e.E, n.E)
+
+	g := mat.NewVecDense(dims, nil)
+	g.MulVec(e.E, n.g)
+	g.AddVec(g, e.g)
+
+	L := mat.NewDense(dims, dims, nil)
+	L.Product(e.E, n.L, e.E.T())
+	L.Add(L, e.L)
+
+	return &smoothingElement{E: E, g: g, L: L}, nil
+}
+
+// scan replaces each element with the combination of all elements up to and including it.
+// If reverse is set, each element is instead replaced with the combination of itself and all
+// elements after it. The elements are split into chunks which are scanned concurrently,
+// and then offset by the combination of the chunks preceding them.
+func scan(elements []scanElement, reverse bool) error {
+	n := len(elements)
+	if n == 0 {
+		return nil
+	}
+
+	at := func(i int) int {
+		if reverse {
+			return n - 1 - i
+		}
+		return i
+	}
+
+	combine := func(earlier, later scanElement) (scanElement, error) {
+		if reverse {
+			return later.combine(earlier)
+		}
+		return earlier.combine(later)
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+
+	size := (n + workers - 1) / workers
+	chunks := (n + size - 1) / size
+
+	bounds := func(c int) (int, int) {
+		end := (c + 1) * size
+		if end > n {
+			end = n
+		}
+		return c * size, end
+	}
+
+	err := parallelChunks(chunks, func(c int) error {
+		start, end := bounds(c)
+		for i := start + 1; i < end; i++ {
+			e, err := combine(elements[at(i-1)], elements[at(i)])
+			if err != nil {
+				return err
+			}
+			elements[at(i)] = e
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// offsets[c] is the combination of all chunks before chunk c.
+	offsets := make([]scanElement, chunks)
+	for c := 1; c < chunks; c++ {
+		_, end := bounds(c - 1)
+		last := elements[at(end-1)]
+
+		if c == 1 {
+			offsets[c] = last
+			continue
+		}
+
+		offsets[c], err = combine(offsets[c-1], last)
+		if err != nil {
+			return err
+		}
+	}
+
+	return parallelChunks(chunks, func(c int) error {
+		if c == 0 {
+			return nil
+		}
+
+		start, end := bounds(c)
+		for i := start; i < end; i++ {
+			e, err := combine(offsets[c], elements[at(i)])
+			if err != nil {
+				return err
+			}
+			elements[at(i)] = e
+		}
+		return nil
+	})
+}
+
+// parallelFor calls f for each index up to n, spreading the calls across goroutines.
+// The first error encountered is returned.
+func parallelFor(n int, f func(i int) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	if workers == 0 {
+		return nil
+	}
+
+	size := (n + workers - 1) / workers
+	chunks := (n + size - 1) / size
+
+	return parallelChunks(chunks, func(c int) error {
+		end := (c + 1) * size
+		if end > n {
+			end = n
+		}
+
+		for i := c * size; i < end; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// parallelChunks calls f for each chunk in its own goroutine, returning the first error.
+func parallelChunks(chunks int, f func(c int) error) error {
+	errs := make([]error, chunks)
+
+	var wg sync.WaitGroup
+	for c := 0; c < chunks; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			errs[c] = f(c)
+		}(c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
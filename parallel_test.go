@@ -0,0 +1,61 @@
+package kalman
+
+import (
+	"runtime"
+	"testing"
+
+	"gonum.org/v1/gonum/floats"
+)
+
+func TestParallelScanMatchesRauchTungStriebel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// The number of measurements isn't divisible by the number of workers.
+	model := newTestModel()
+	ms := newNoisyTestMeasurements(model, 103)
+
+	expected := NewKalmanSmoother(model)
+	actual := NewKalmanSmoother(model)
+	actual.SetSmoothingMethod(ParallelScan)
+
+	expectedResult, err := expected.SmoothWithDiagnostics(ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualResult, err := actual.SmoothWithDiagnostics(ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatesNear(t, expectedResult.Smoothed, actualResult.Smoothed, 1e-9)
+	assertStatesNear(t, expectedResult.APriori, actualResult.APriori, 1e-9)
+	assertStatesNear(t, expectedResult.APosteriori, actualResult.APosteriori, 1e-9)
+
+	if len(expectedResult.Gains) != len(actualResult.Gains) {
+		t.Fatalf("expected %d gains, got %d", len(expectedResult.Gains), len(actualResult.Gains))
+	}
+
+	for i := range expectedResult.Gains {
+		assertMatNear(t, expectedResult.Gains[i], actualResult.Gains[i], 1e-9)
+		assertMatNear(t, expectedResult.CrossCovariances[i], actualResult.CrossCovariances[i], 1e-9)
+	}
+
+	if !floats.EqualApprox(expectedResult.LogLikelihoods, actualResult.LogLikelihoods, 1e-9) {
+		t.Errorf("expected log-likelihoods %v, got %v", expectedResult.LogLikelihoods, actualResult.LogLikelihoods)
+	}
+
+	times := newTestQueryTimes(ms)
+
+	expectedStates, err := expected.SmoothAt(times, ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualStates, err := actual.SmoothAt(times, ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatesNear(t, expectedStates, actualStates, 1e-9)
+}
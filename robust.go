@@ -0,0 +1,171 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// RobustLoss determines the weight given to a measurement from the
+// Mahalanobis distance of its residual. A weight of 1 fuses the measurement
+// with its nominal covariance, smaller weights inflate the covariance by 1/weight.
+type RobustLoss interface {
+	Weight(distance float64, dims int) float64
+}
+
+// HuberLoss is quadratic for residuals within Threshold standard deviations,
+// and linear beyond. Measurements within the threshold are fused unchanged.
+// Threshold must be positive.
+type HuberLoss struct {
+	Threshold float64
+}
+
+// Weight implements RobustLoss.
+func (l HuberLoss) Weight(distance float64, dims int) float64 {
+	if distance <= l.Threshold {
+		return 1.0
+	}
+
+	return l.Threshold / distance
+}
+
+func (l HuberLoss) validate() error {
+	if !(l.Threshold > 0) {
+		return fmt.Errorf("huber loss threshold must be positive, got %v", l.Threshold)
+	}
+
+	return nil
+}
+
+// StudentTLoss corresponds to measurement noise following a multivariate Student-t
+// distribution with the given degrees of freedom. Fewer degrees of freedom
+// give heavier tails, and so more aggressive down-weighting of large residuals.
+// DegreesOfFreedom must be positive.
+type StudentTLoss struct {
+	DegreesOfFreedom float64
+}
+
+// Weight implements RobustLoss.
+func (l StudentTLoss) Weight(distance float64, dims int) float64 {
+	return (l.DegreesOfFreedom + float64(dims)) / (l.DegreesOfFreedom + distance*distance)
+}
+
+func (l StudentTLoss) validate() error {
+	if !(l.DegreesOfFreedom > 0) {
+		return fmt.Errorf("student-t loss degrees of freedom must be positive, got %v", l.DegreesOfFreedom)
+	}
+
+	return nil
+}
+
+// RobustUpdate configures an iteratively reweighted measurement update.
+// At each iteration, the measurement is fused with its covariance scaled by 1/weight,
+// and the weight is then re-estimated by the Loss from the expected Mahalanobis distance
+// of the measurement residual under the resulting a posteriori state.
+// Iteration stops when the weight changes by less than Tolerance.
+type RobustUpdate struct {
+	Loss RobustLoss
+
+	// MaxIterations defaults to 10 if zero.
+	MaxIterations int
+	// Tolerance defaults to 1e-6 if zero.
+	Tolerance float64
+}
+
+// validate returns an error if the robust update is misconfigured.
+// The parameters of the built-in losses are checked, custom losses are assumed to be valid.
+func (r *RobustUpdate) validate() error {
+	if r.Loss == nil {
+		return fmt.Errorf("robust update has no loss")
+	}
+
+	if r.MaxIterations < 0 || r.Tolerance < 0 {
+		return fmt.Errorf("robust update iterations and tolerance can't be negative")
+	}
+
+	if l, ok := r.Loss.(interface{ validate() error }); ok {
+		return l.validate()
+	}
+
+	return nil
+}
+
+// robustWeight iteratively computes the weight of the measurement, such that
+// the measurement should be fused with covariance R/weight.
+func robustWeight(state *mat.VecDense, P, H, R mat.Matrix, m *models.Measurement, preFitResidual mat.Vector, cfg UpdateConfig) (float64, error) {
+	robust := cfg.Robust
+
+	err := robust.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	maxIterations := robust.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = 10
+	}
+
+	tolerance := robust.Tolerance
+	if tolerance == 0 {
+		tolerance = 1e-6
+	}
+
+	dims := preFitResidual.Len()
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(R)); !ok {
+		return 0, fmt.Errorf("measurement covariance is not positive definite")
+	}
+
+	weight := 1.0
+	scaled := mat.NewDense(dims, dims, nil)
+
+	for i := 0; i < maxIterations; i++ {
+		scaled.Scale(1/weight, R)
+
+		preFitResidualCov, _, err := innovation(P, H, scaled, preFitResidual)
+		if err != nil {
+			return 0, err
+		}
+
+		gain, err := kalmanGain(P, H, preFitResidualCov, cfg)
+		if err != nil {
+			return 0, err
+		}
+
+		newState, newCovariance := applyGain(state, P, H, scaled, gain, preFitResidual, cfg)
+
+		// E[d^2] = e^T R^-1 e + tr(R^-1 H P H^T) for the a posteriori residual e and covariance P.
+		residual := mat.NewVecDense(dims, nil)
+		residual.SubVec(m.Value, m.Observe(newState))
+
+		whitened := mat.NewVecDense(dims, nil)
+		err = chol.SolveVecTo(whitened, residual)
+		if err != nil {
+			return 0, fmt.Errorf("measurement covariance is singular: %s", err)
+		}
+
+		projected := mat.NewDense(dims, dims, nil)
+		projected.Product(H, newCovariance, H.T())
+
+		solved := mat.NewDense(dims, dims, nil)
+		err = chol.SolveTo(solved, projected)
+		if err != nil {
+			return 0, fmt.Errorf("measurement covariance is singular: %s", err)
+		}
+
+		distance := math.Sqrt(mat.Dot(residual, whitened) + mat.Trace(solved))
+		newWeight := robust.Loss.Weight(distance, dims)
+
+		converged := math.Abs(newWeight-weight) < tolerance
+		weight = newWeight
+
+		if converged {
+			break
+		}
+	}
+
+	return weight, nil
+}
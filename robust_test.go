@@ -0,0 +1,49 @@
+package kalman
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestRobustUpdateDownWeightsOutliers(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 1)
+	outlier := model.NewPositionMeasurement(mat.NewVecDense(1, []float64{100}), 0.1)
+
+	filter := NewKalmanFilter(model)
+	filter.SetUpdateConfig(UpdateConfig{Robust: &RobustUpdate{Loss: HuberLoss{Threshold: 2}}})
+
+	result, err := filter.UpdateWithResult(ms[0].Time, outlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CovarianceScale <= 1 {
+		t.Fatalf("expected the outlier to be down-weighted, got covariance scale %v", result.CovarianceScale)
+	}
+}
+
+func TestRobustUpdateWithInvalidLossIsAnError(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 1)
+
+	losses := []RobustLoss{
+		nil,
+		HuberLoss{},
+		HuberLoss{Threshold: -1},
+		&HuberLoss{},
+		StudentTLoss{},
+		StudentTLoss{DegreesOfFreedom: -3},
+	}
+
+	for _, loss := range losses {
+		filter := NewKalmanFilter(model)
+		filter.SetUpdateConfig(UpdateConfig{Robust: &RobustUpdate{Loss: loss}})
+
+		err := filter.Update(ms[0].Time, &ms[0].Measurement)
+		if err == nil {
+			t.Errorf("expected an error for loss %#v", loss)
+		}
+	}
+}
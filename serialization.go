@@ -0,0 +1,153 @@
+package kalman
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// kalmanFilterData is the serialized form of a KalmanFilter.
+type kalmanFilterData struct {
+	Estimate      models.State `json:"estimate"`
+	LogLikelihood float64      `json:"log_likelihood"`
+	HistoryLength int          `json:"history_length"`
+}
+
+// measurementAtTimeData is the serialized form of a MeasurementAtTime.
+type measurementAtTimeData struct {
+	Time        time.Time          `json:"time"`
+	Measurement models.Measurement `json:"measurement"`
+}
+
+// MarshalJSON implements json.Marshaler.
+// The current estimate of the filter is serialized, but the model, the update config and
+// any retained history of measurements are not.
+func (kf *KalmanFilter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(kf.data())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// The filter must have been created with NewKalmanFilter, using the same model as the
+// filter that was serialized.
+func (kf *KalmanFilter) UnmarshalJSON(b []byte) error {
+	var d kalmanFilterData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	return kf.setData(d)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+// See MarshalJSON for the parts of the filter that are serialized.
+func (kf *KalmanFilter) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(kf.data()); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// See UnmarshalJSON for the requirements on the filter.
+func (kf *KalmanFilter) UnmarshalBinary(b []byte) error {
+	var d kalmanFilterData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&d); err != nil {
+		return err
+	}
+
+	return kf.setData(d)
+}
+
+func (kf *KalmanFilter) data() kalmanFilterData {
+	return kalmanFilterData{
+		Estimate: models.State{
+			Time:       kf.t,
+			State:      kf.state,
+			Covariance: kf.covariance,
+		},
+		LogLikelihood: kf.logLikelihood,
+		HistoryLength: kf.historyLength,
+	}
+}
+
+func (kf *KalmanFilter) setData(d kalmanFilterData) error {
+	if kf.model == nil {
+		return fmt.Errorf("filter has no model, it must be created with NewKalmanFilter")
+	}
+
+	if d.Estimate.State == nil || d.Estimate.Covariance == nil {
+		return fmt.Errorf("missing estimate")
+	}
+
+	if d.Estimate.State.Len() != kf.dims {
+		return fmt.Errorf("state has incorrect number of entries: %d (expected %d)", d.Estimate.State.Len(), kf.dims)
+	}
+
+	if r, c := d.Estimate.Covariance.Dims(); r != kf.dims || c != kf.dims {
+		return fmt.Errorf("covariance has incorrect size: %dx%d (expected %dx%d)", r, c, kf.dims, kf.dims)
+	}
+
+	kf.t = d.Estimate.Time
+	kf.state = mat.VecDenseCopyOf(d.Estimate.State)
+	kf.covariance = mat.DenseCopyOf(d.Estimate.Covariance)
+	kf.logLikelihood = d.LogLikelihood
+	kf.historyLength = d.HistoryLength
+	kf.resetHistory()
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m MeasurementAtTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(measurementAtTimeData{
+		Time:        m.Time,
+		Measurement: m.Measurement,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *MeasurementAtTime) UnmarshalJSON(b []byte) error {
+	var d measurementAtTimeData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	m.Time = d.Time
+	m.Measurement = d.Measurement
+
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, and so is used by encoding/gob.
+func (m MeasurementAtTime) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	err := gob.NewEncoder(&b).Encode(measurementAtTimeData{
+		Time:        m.Time,
+		Measurement: m.Measurement,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *MeasurementAtTime) UnmarshalBinary(b []byte) error {
+	var d measurementAtTimeData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&d); err != nil {
+		return err
+	}
+
+	m.Time = d.Time
+	m.Measurement = d.Measurement
+
+	return nil
+}
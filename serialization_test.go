@@ -0,0 +1,118 @@
+package kalman
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestKalmanFilterRoundTrip(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 5)
+
+	filter := NewKalmanFilter(model)
+	filter.SetHistoryLength(3)
+	for _, m := range ms[:3] {
+		if err := filter.Update(m.Time, &m.Measurement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encodings := map[string]struct {
+		encode func(*KalmanFilter) ([]byte, error)
+		decode func([]byte, *KalmanFilter) error
+	}{
+		"json": {
+			encode: func(kf *KalmanFilter) ([]byte, error) { return json.Marshal(kf) },
+			decode: func(b []byte, kf *KalmanFilter) error { return json.Unmarshal(b, kf) },
+		},
+		"gob": {
+			encode: func(kf *KalmanFilter) ([]byte, error) {
+				var b bytes.Buffer
+				err := gob.NewEncoder(&b).Encode(kf)
+				return b.Bytes(), err
+			},
+			decode: func(b []byte, kf *KalmanFilter) error {
+				return gob.NewDecoder(bytes.NewReader(b)).Decode(kf)
+			},
+		},
+	}
+
+	for name, encoding := range encodings {
+		b, err := encoding.encode(filter)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		decoded := NewKalmanFilter(model)
+		if err := encoding.decode(b, decoded); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if !decoded.Time().Equal(filter.Time()) {
+			t.Errorf("%s: expected time %s, got %s", name, filter.Time(), decoded.Time())
+		}
+
+		if decoded.LogLikelihood() != filter.LogLikelihood() {
+			t.Errorf("%s: expected log-likelihood %f, got %f", name, filter.LogLikelihood(), decoded.LogLikelihood())
+		}
+
+		assertVecNear(t, filter.State(), decoded.State(), 0)
+		assertMatNear(t, filter.Covariance(), decoded.Covariance(), 0)
+
+		// The decoded filter retains measurements fused after it was decoded.
+		for _, m := range ms[3:] {
+			if err := decoded.Update(m.Time, &m.Measurement); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+
+		if _, err := decoded.Rewind(ms[3].Time); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestKalmanFilterInvalidPayloadIsAnError(t *testing.T) {
+	payloads := map[string]string{
+		"missing covariance": `{"estimate": {"state": [0, 0]}}`,
+		"state length":       `{"estimate": {"state": [0], "covariance": [[1]]}}`,
+		"covariance size":    `{"estimate": {"state": [0, 0], "covariance": [[1]]}}`,
+	}
+
+	for name, payload := range payloads {
+		filter := NewKalmanFilter(newTestModel())
+		if err := json.Unmarshal([]byte(payload), filter); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"estimate": {"state": [0, 0], "covariance": [[1, 0], [0, 1]]}}`), &KalmanFilter{}); err == nil {
+		t.Errorf("expected an error for a filter without a model")
+	}
+}
+
+func TestMeasurementAtTimeRoundTrip(t *testing.T) {
+	m := newTestMeasurements(newTestModel(), 1)[0]
+	m.Time = time.Unix(100, 0).UTC()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded MeasurementAtTime
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.Time.Equal(m.Time) {
+		t.Errorf("expected time %s, got %s", m.Time, decoded.Time)
+	}
+
+	assertVecNear(t, m.Value, decoded.Value, 0)
+	assertMatNear(t, m.Covariance, decoded.Covariance, 0)
+	assertMatNear(t, m.ObservationModel, decoded.ObservationModel, 0)
+}
@@ -1,6 +1,7 @@
 package kalman
 
 import (
+	"sort"
 	"time"
 
 	"github.com/rosshemsley/kalman/models"
@@ -8,6 +9,9 @@ import (
 )
 
 type kalmanStateChange struct {
+	// The time of the measurement.
+	time time.Time
+
 	// The transition used to advance the model from the previous
 	// aPosteriori estimate to the current a Priori estimate.
 	// x_{k|k-1} = F_k x_{k-1}
@@ -20,11 +24,25 @@ type kalmanStateChange struct {
 	// State after measurement taken, x_{k|k}, P_{k|k}
 	APoseterioriState mat.Vector
 	aPosterioriCovariance mat.Matrix
+
+	// The contribution of the measurement to the log-likelihood of the model.
+	logLikelihood float64
+
+	// The process noise added by the transition, Q_k.
+	processNoise mat.Matrix
+
+	// The measurement as it was fused, linearized about the a priori state
+	// and with its covariance scaled by any gate or robust update.
+	// This is nil if there was no measurement, or if it was rejected.
+	measurement *models.Measurement
 }
 
 // KalmanSmoother implements Rauch–Tung–Striebel smoothing.
+// Two-filter and parallel smoothing may also be selected using SetSmoothingMethod.
 type KalmanSmoother struct {
-	model models.LinearModel
+	model        models.LinearModel
+	updateConfig UpdateConfig
+	method       SmoothingMethod
 }
 
 // NewKalmanSmoother creates a new smoother for the given model.
@@ -34,6 +52,46 @@ func NewKalmanSmoother(model models.LinearModel) *KalmanSmoother {
 	}
 }
 
+// SetUpdateConfig selects how measurements are fused during the forward pass of the smoother.
+func (kf *KalmanSmoother) SetUpdateConfig(cfg UpdateConfig) {
+	kf.updateConfig = cfg
+}
+
+// SmoothingMethod selects the algorithm used by the KalmanSmoother.
+type SmoothingMethod int
+
+const (
+	// RauchTungStriebel corrects the forward estimates using a backwards recursion over
+	// the smoothed states. This requires inverting the a priori covariance of every step.
+	RauchTungStriebel SmoothingMethod = iota
+	// TwoFilter combines the forward estimates with those of a backwards information filter.
+	// This avoids inverting the a priori covariances, which can be ill-conditioned when
+	// parts of the state are nearly deterministic.
+	// Gains and cross covariances are not computed by this method.
+	TwoFilter
+	// ParallelScan computes both the forwards and backwards passes as associative scans,
+	// which are spread across goroutines. It requires linear measurements,
+	// and doesn't support gates or robust updates.
+	ParallelScan
+)
+
+// SetSmoothingMethod selects the algorithm used by the smoother.
+func (kf *KalmanSmoother) SetSmoothingMethod(method SmoothingMethod) {
+	kf.method = method
+}
+
+// smoothBackwards performs the backwards pass selected for the smoother.
+func (kf *KalmanSmoother) smoothBackwards(ss []kalmanStateChange) (*backwardsPass, error) {
+	switch kf.method {
+	case TwoFilter:
+		return smoothTwoFilter(ss)
+	case ParallelScan:
+		return smoothParallel(ss)
+	default:
+		return smoothBackwards(ss)
+	}
+}
+
 // MeasurementAtTime represents a measurement taken at a given time.
 type MeasurementAtTime struct {
 	models.Measurement
@@ -48,9 +106,24 @@ func NewMeasurementAtTime(t time.Time, m *models.Measurement) *MeasurementAtTime
 	}
 }
 
+// SortMeasurements merges the given batches of measurements into a single batch,
+// stably sorted by time, so that it may be smoothed.
+func SortMeasurements(batches ...[]*MeasurementAtTime) []*MeasurementAtTime {
+	var result []*MeasurementAtTime
+	for _, batch := range batches {
+		result = append(result, batch...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+
+	return result
+}
+
 // Smooth computes optimal estimates of the model states by using all measurements.
 // This is done by running a regular Kalman Filter and then performing a backwards pass
-// using the Rauch–Tung–Striebel algorithm.
+// using the Rauch–Tung–Striebel algorithm, or the method selected with SetSmoothingMethod.
 // Better results can be achieved since each state is estimated based on the entire history
 // of the process, including the future and past observations.
 func (kf *KalmanSmoother)Smooth(measurements ...*MeasurementAtTime) ([]models.State, error){
@@ -63,71 +136,360 @@ func (kf *KalmanSmoother)Smooth(measurements ...*MeasurementAtTime) ([]models.St
 	if err != nil {
 		return nil, err
 	}
-	
+
+	smoothed, err := kf.smoothBackwards(ss)
+	if err != nil {
+		return nil, err
+	}
+
+	return smoothed.states, nil
+}
+
+// SmoothResult holds the smoothed states along with the intermediate results of the smoother.
+// Each slice has one entry per measurement, except for Gains and CrossCovariances,
+// which have one entry for each consecutive pair of measurements, and are only
+// computed by the Rauch–Tung–Striebel method.
+type SmoothResult struct {
+	// Smoothed holds the estimates using all measurements, x_{k|n}, P_{k|n}.
+	Smoothed []models.State
+	// APriori holds the filtered estimates before each measurement, x_{k|k-1}, P_{k|k-1}.
+	APriori []models.State
+	// APosteriori holds the filtered estimates after each measurement, x_{k|k}, P_{k|k}.
+	APosteriori []models.State
+
+	// Gains[k] is the smoother gain C_k = P_{k|k} F_{k+1}^T P_{k+1|k}^-1.
+	Gains []mat.Matrix
+	// CrossCovariances[k] is the lag-one cross covariance of the smoothed states, P_{k+1,k|n}.
+	CrossCovariances []mat.Matrix
+
+	// LogLikelihoods holds the contribution of each measurement to LogLikelihood.
+	LogLikelihoods []float64
+	// LogLikelihood is the log-likelihood of all measurements under the model.
+	LogLikelihood float64
+}
+
+// SmoothWithDiagnostics is identical to Smooth, but also returns the filtered estimates
+// and the other intermediate results computed by the smoother.
+func (kf *KalmanSmoother) SmoothWithDiagnostics(measurements ...*MeasurementAtTime) (*SmoothResult, error) {
+	n := len(measurements)
+	if n == 0 {
+		return &SmoothResult{
+			Smoothed:         make([]models.State, 0),
+			APriori:          make([]models.State, 0),
+			APosteriori:      make([]models.State, 0),
+			Gains:            make([]mat.Matrix, 0),
+			CrossCovariances: make([]mat.Matrix, 0),
+			LogLikelihoods:   make([]float64, 0),
+		}, nil
+	}
+
+	ss, err := kf.computeForwardsStateChanges(measurements...)
+	if err != nil {
+		return nil, err
+	}
+
+	smoothed, err := kf.smoothBackwards(ss)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SmoothResult{
+		Smoothed:         smoothed.states,
+		APriori:          make([]models.State, n),
+		APosteriori:      make([]models.State, n),
+		Gains:            smoothed.gains,
+		CrossCovariances: smoothed.crossCovariances,
+		LogLikelihoods:   make([]float64, n),
+	}
+
+	for i, s := range ss {
+		result.APriori[i] = models.State{
+			Time:       s.time,
+			State:      s.aPrioriState,
+			Covariance: s.aPrioriCovariance,
+		}
+		result.APosteriori[i] = models.State{
+			Time:       s.time,
+			State:      s.APoseterioriState,
+			Covariance: s.aPosterioriCovariance,
+		}
+		result.LogLikelihoods[i] = s.logLikelihood
+		result.LogLikelihood += s.logLikelihood
+	}
+
+	return result, nil
+}
+
+// SmoothAt computes smoothed estimates of the model state at each of the given times,
+// using all measurements. The times need not coincide with the times of measurements,
+// nor be sorted, and one state is returned for each, in the order given.
+// Estimates at the times of measurements include the effect of those measurements.
+func (kf *KalmanSmoother) SmoothAt(times []time.Time, measurements ...*MeasurementAtTime) ([]models.State, error) {
+	if len(times) == 0 {
+		return make([]models.State, 0), nil
+	}
+
+	queries := make([]int, len(times))
+	for i := range queries {
+		queries[i] = i
+	}
+	sort.SliceStable(queries, func(i, j int) bool {
+		return times[queries[i]].Before(times[queries[j]])
+	})
+
+	err := checkOrder(kf.model.InitialState().Time, measurements)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := NewKalmanFilter(kf.model)
+	filter.SetUpdateConfig(kf.updateConfig)
+
+	ss := make([]kalmanStateChange, 0, len(measurements)+len(times))
+	indices := make([]int, 0, len(times))
+
+	next := 0
+	for _, i := range queries {
+		for next < len(measurements) && !measurements[next].Time.After(times[i]) {
+			stateChange, err := forwardStep(filter, kf.model, measurements[next])
+			if err != nil {
+				return nil, atIndex(err, next)
+			}
+
+			ss = append(ss, *stateChange)
+			next++
+		}
+
+		stateChange, err := predictStep(filter, kf.model, times[i])
+		if err != nil {
+			return nil, err
+		}
+
+		indices = append(indices, len(ss))
+		ss = append(ss, *stateChange)
+	}
+
+	for ; next < len(measurements); next++ {
+		stateChange, err := forwardStep(filter, kf.model, measurements[next])
+		if err != nil {
+			return nil, atIndex(err, next)
+		}
+
+		ss = append(ss, *stateChange)
+	}
+
+	smoothed, err := kf.smoothBackwards(ss)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.State, len(times))
+	for j, i := range queries {
+		result[i] = smoothed.states[indices[j]]
+	}
+
+	return result, nil
+}
+
+// backwardsPass holds the results of the backwards pass of the smoother.
+type backwardsPass struct {
+	states []models.State
+
+	// gains[i] is the smoother gain C_i = P_{i|i} F_{i+1}^T P_{i+1|i}^-1 relating
+	// step i to step i+1.
+	gains []mat.Matrix
+
+	// crossCovariances[i] is the lag-one cross covariance of the smoothed states,
+	// P_{i+1,i|n} = P_{i+1|n} C_i^T.
+	crossCovariances []mat.Matrix
+}
+
+// smoothBackwards performs the Rauch–Tung–Striebel backwards pass over the
+// state changes computed by the forwards pass.
+func smoothBackwards(ss []kalmanStateChange) (*backwardsPass, error) {
+	n := len(ss)
 	dims := ss[0].aPrioriState.Len()
-	C := mat.NewDense(dims, dims, nil)
 	aPrioriCovarianceInv := mat.NewDense(dims, dims, nil)
 
-	result := make([]models.State, n)
-	result[n-1].State = ss[n-1].APoseterioriState
-	result[n-1].Covariance = ss[n-1].aPosterioriCovariance
+	result := &backwardsPass{
+		states:           make([]models.State, n),
+		gains:            make([]mat.Matrix, n-1),
+		crossCovariances: make([]mat.Matrix, n-1),
+	}
+	result.states[n-1].Time = ss[n-1].time
+	result.states[n-1].State = ss[n-1].APoseterioriState
+	result.states[n-1].Covariance = ss[n-1].aPosterioriCovariance
 
 	x := mat.NewVecDense(dims, nil)
 	P := mat.NewDense(dims, dims, nil)
 
-	for i := n - 2 ; i >= 0; i-- {
-		err = aPrioriCovarianceInv.Inverse(ss[i+1].aPrioriCovariance)
+	for i := n - 2; i >= 0; i-- {
+		err := aPrioriCovarianceInv.Inverse(ss[i+1].aPrioriCovariance)
 		if err != nil {
-			panic(err)
+			return nil, &SingularCovarianceError{Index: i + 1, Err: err}
 		}
 
+		C := mat.NewDense(dims, dims, nil)
 		C.Product(
 			ss[i].aPosterioriCovariance,
 			ss[i+1].modelTransition.T(),
 			aPrioriCovarianceInv,
 		)
 
-		x.SubVec(result[i+1].State, ss[i+1].aPrioriState)
+		x.SubVec(result.states[i+1].State, ss[i+1].aPrioriState)
 		x.MulVec(C, x)
 		x.AddVec(ss[i].APoseterioriState, x)
-		
-		P.Sub(result[i+1].Covariance, ss[i+1].aPrioriCovariance)
+
+		P.Sub(result.states[i+1].Covariance, ss[i+1].aPrioriCovariance)
 		P.Product(C, P, C.T())
 		P.Add(ss[i].aPosterioriCovariance, P)
 
-		result[i].State = mat.VecDenseCopyOf(x)
-		result[i].Covariance = mat.DenseCopyOf(P)
+		crossCovariance := mat.NewDense(dims, dims, nil)
+		crossCovariance.Mul(result.states[i+1].Covariance, C.T())
+
+		result.states[i].Time = ss[i].time
+		result.states[i].State = mat.VecDenseCopyOf(x)
+		result.states[i].Covariance = mat.DenseCopyOf(P)
+		result.gains[i] = C
+		result.crossCovariances[i] = crossCovariance
 	}
 
 	return result, nil
 }
 
+// LogLikelihood computes the log-likelihood of the given measurements under the model,
+// returning the total along with the contribution of each measurement.
+// Only the forwards pass of the smoother is required to compute the log-likelihood.
+func (kf *KalmanSmoother) LogLikelihood(measurements ...*MeasurementAtTime) (float64, []float64, error) {
+	ss, err := kf.computeForwardsStateChanges(measurements...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	total := 0.0
+	result := make([]float64, len(ss))
+	for i, s := range ss {
+		result[i] = s.logLikelihood
+		total += s.logLikelihood
+	}
+
+	return total, result, nil
+}
+
 // computeForwardsStateChanges runs the regular KalmanFilter for the given measurements.
 func (kf *KalmanSmoother)computeForwardsStateChanges(measurements ...*MeasurementAtTime) ([]kalmanStateChange, error) {
+	err := checkOrder(kf.model.InitialState().Time, measurements)
+	if err != nil {
+		return nil, err
+	}
+
+	if kf.method == ParallelScan {
+		return kf.computeForwardsStateChangesParallel(measurements)
+	}
+
 	filter := NewKalmanFilter(kf.model)
+	filter.SetUpdateConfig(kf.updateConfig)
 	result := make([]kalmanStateChange, len(measurements))
 
 	for i, m := range measurements {
-		stateChange := &result[i]
-		dt := m.Time.Sub(filter.Time())
-
-		stateChange.modelTransition = mat.DenseCopyOf(kf.model.Transition(dt))
-		err := filter.Predict(m.Time)
+		stateChange, err := forwardStep(filter, kf.model, m)
 		if err != nil {
-			return nil, err
+			return nil, atIndex(err, i)
 		}
 
-		stateChange.aPrioriState = mat.VecDenseCopyOf(filter.State())
-		stateChange.aPrioriCovariance = mat.DenseCopyOf(filter.Covariance())
+		result[i] = *stateChange
+	}
 
-		err = filter.Update(m.Time, &m.Measurement)
-		if err != nil {
-			return nil, err
+	return result, nil
+}
+
+// forwardStep fuses a single measurement into the filter, recording the state change.
+func forwardStep(filter *KalmanFilter, model models.LinearModel, m *MeasurementAtTime) (*kalmanStateChange, error) {
+	stateChange, err := predictStep(filter, model, m.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	updateResult, err := filter.UpdateWithResult(m.Time, &m.Measurement)
+	if err != nil {
+		return nil, err
+	}
+
+	if !updateResult.Rejected {
+		stateChange.logLikelihood = updateResult.LogLikelihood
+	}
+
+	stateChange.APoseterioriState = mat.VecDenseCopyOf(filter.State())
+	stateChange.aPosterioriCovariance = mat.DenseCopyOf(filter.Covariance())
+
+	if !updateResult.Rejected {
+		stateChange.measurement = linearizedMeasurement(stateChange.aPrioriState, &m.Measurement, updateResult)
+	}
+
+	return stateChange, nil
+}
+
+// linearizedMeasurement returns the linear measurement equivalent to the given measurement
+// about the state x, z' = z - h(x) + Hx, with the covariance used by the update.
+func linearizedMeasurement(x mat.Vector, m *models.Measurement, result *UpdateResult) *models.Measurement {
+	H := mat.DenseCopyOf(m.Jacobian(x))
+
+	value := mat.NewVecDense(m.Value.Len(), nil)
+	value.MulVec(H, x)
+	value.AddVec(result.PreFitResidual, value)
+
+	covariance := mat.DenseCopyOf(m.Covariance)
+	covariance.Scale(result.CovarianceScale, covariance)
+
+	return &models.Measurement{
+		Value:            value,
+		Covariance:       covariance,
+		ObservationModel: H,
+	}
+}
+
+// predictStep advances the filter to time t without a measurement, recording the state change.
+// The a posteriori estimate of the state change is the same as the a priori estimate.
+func predictStep(filter *KalmanFilter, model models.LinearModel, t time.Time) (*kalmanStateChange, error) {
+	stateChange := &kalmanStateChange{time: t}
+	dt := t.Sub(filter.Time())
+
+	stateChange.modelTransition = mat.DenseCopyOf(model.Transition(dt))
+	stateChange.processNoise = mat.DenseCopyOf(model.CovarianceTransition(dt))
+	err := filter.Predict(t)
+	if err != nil {
+		return nil, err
+	}
+
+	stateChange.aPrioriState = mat.VecDenseCopyOf(filter.State())
+	stateChange.aPrioriCovariance = mat.DenseCopyOf(filter.Covariance())
+	stateChange.APoseterioriState = stateChange.aPrioriState
+	stateChange.aPosterioriCovariance = stateChange.aPrioriCovariance
+
+	return stateChange, nil
+}
+
+// checkOrder returns an UnsortedMeasurementError if the measurements are not in order of time,
+// or if any is before the given initial time.
+func checkOrder(initial time.Time, measurements []*MeasurementAtTime) error {
+	previous := initial
+
+	for i, m := range measurements {
+		if m.Time.Before(previous) {
+			return &UnsortedMeasurementError{Index: i, Time: m.Time, Previous: previous}
 		}
 
-		stateChange.APoseterioriState = mat.VecDenseCopyOf(filter.State())
-		stateChange.aPosterioriCovariance = mat.DenseCopyOf(filter.Covariance())
+		previous = m.Time
 	}
 
-	return result, nil
+	return nil
+}
+
+// atIndex sets the index of the measurement that caused the given error, where relevant.
+func atIndex(err error, i int) error {
+	if e, ok := err.(*DimensionMismatchError); ok {
+		e.Index = i
+	}
+
+	return err
 }
@@ -0,0 +1,293 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// SquareRootKalmanFilter is a KalmanFilter that propagates a lower triangular
+// factor S of the covariance, P = SS^T, rather than the covariance itself.
+// Both prediction and update are computed using orthogonal transformations
+// of the factor, which roughly doubles the precision available to the covariance.
+// This is useful when the state mixes quantities of very different scales.
+type SquareRootKalmanFilter struct {
+	model models.LinearModel
+
+	dims   int
+	t      time.Time
+	state  *mat.VecDense
+	factor *mat.TriDense
+}
+
+// NewSquareRootKalmanFilter returns a new SquareRootKalmanFilter for the given linear model.
+// An error is returned if the initial covariance of the model is not positive semi-definite.
+func NewSquareRootKalmanFilter(model models.LinearModel) (*SquareRootKalmanFilter, error) {
+	initial := model.InitialState()
+	dims := initial.State.Len()
+
+	factor, err := covarianceFactor(initial.Covariance, dims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial covariance: %s", err)
+	}
+
+	return &SquareRootKalmanFilter{
+		model:  model,
+		dims:   dims,
+		t:      initial.Time,
+		state:  mat.VecDenseCopyOf(initial.State),
+		factor: factor,
+	}, nil
+}
+
+// State returns the current hidden state of the SquareRootKalmanFilter.
+func (kf *SquareRootKalmanFilter) State() mat.Vector {
+	return kf.state
+}
+
+// Covariance returns the current covariance of the model, computed from its factor.
+func (kf *SquareRootKalmanFilter) Covariance() mat.Matrix {
+	result := mat.NewDense(kf.dims, kf.dims, nil)
+	result.Mul(kf.factor, kf.factor.T())
+	return result
+}
+
+// SquareRootCovariance returns the lower triangular factor S of the current covariance,
+// such that P = SS^T.
+func (kf *SquareRootKalmanFilter) SquareRootCovariance() mat.Triangular {
+	return kf.factor
+}
+
+// SetCovariance resets the covariance of the filter to the given value.
+// An error is returned if the covariance is not positive semi-definite,
+// in which case the filter is unchanged.
+func (kf *SquareRootKalmanFilter) SetCovariance(covariance mat.Matrix) error {
+	factor, err := covarianceFactor(covariance, kf.dims)
+	if err != nil {
+		return fmt.Errorf("invalid covariance: %s", err)
+	}
+
+	kf.factor = factor
+	return nil
+}
+
+// SetState resets the state of the filter to the given value.
+func (kf *SquareRootKalmanFilter) SetState(state mat.Vector) {
+	kf.state = mat.VecDenseCopyOf(state)
+}
+
+// Time returns the time for which the current hidden state is an estimate.
+// The time is monotone increasing.
+func (kf *SquareRootKalmanFilter) Time() time.Time {
+	return kf.t
+}
+
+// Predict advances the filter from the internal current time
+// to the given time using the built-in linear model.
+// Each time can be no earlier than the current time of the filter.
+func (kf *SquareRootKalmanFilter) Predict(t time.Time) error {
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.Equal(kf.t) {
+		return nil
+	}
+
+	dt := t.Sub(kf.t)
+
+	T := kf.model.Transition(dt)
+
+	processNoiseFactor, err := squareRoot(kf.model.CovarianceTransition(dt))
+	if err != nil {
+		return fmt.Errorf("invalid process noise: %s", err)
+	}
+
+	// The new factor is found by triangularizing [TS Q^1/2], since
+	// [TS Q^1/2][TS Q^1/2]^T = TPT^T + Q.
+	TS := mat.NewDense(kf.dims, kf.dims, nil)
+	TS.Mul(T, kf.factor)
+
+	pre := mat.NewDense(kf.dims, 2*kf.dims, nil)
+	pre.Slice(0, kf.dims, 0, kf.dims).(*mat.Dense).Copy(TS)
+	pre.Slice(0, kf.dims, kf.dims, 2*kf.dims).(*mat.Dense).Copy(processNoiseFactor)
+
+	post := lowerTriangularize(pre)
+
+	kf.state.MulVec(T, kf.state)
+	kf.factor = triangularPart(post, kf.dims)
+	kf.t = t
+
+	return nil
+}
+
+// Update is used to take a new measurement from a sensor and fuse it to the model.
+// Nonlinear measurements are linearized about the current state estimate.
+// The time field must be no earlier than the current time of the filter.
+func (kf *SquareRootKalmanFilter) Update(t time.Time, m *models.Measurement) error {
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.After(kf.t) {
+		err := kf.Predict(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := checkJacobian(m)
+	if err != nil {
+		return err
+	}
+
+	err = checkMeasurement(m, kf.state)
+	if err != nil {
+		return err
+	}
+
+	n := kf.dims
+	z := m.Value
+	k := z.Len()
+	H := m.Jacobian(kf.state)
+
+	noiseFactor, err := squareRoot(m.Covariance)
+	if err != nil {
+		return fmt.Errorf("invalid measurement covariance: %s", err)
+	}
+
+	HS := mat.NewDense(k, n, nil)
+	HS.Mul(H, kf.factor)
+
+	// Triangularizing the pre-array
+	//   [ R^1/2  HS ]
+	//   [   0     S ]
+	// gives the post-array
+	//   [ S_e^1/2   0  ]
+	//   [   K'     S+ ]
+	// where S_e is the innovation covariance, K = K' S_e^-1/2 is the Kalman gain,
+	// and S+ is the factor of the a posteriori covariance.
+	pre := mat.NewDense(k+n, k+n, nil)
+	pre.Slice(0, k, 0, k).(*mat.Dense).Copy(noiseFactor)
+	pre.Slice(0, k, k, k+n).(*mat.Dense).Copy(HS)
+	pre.Slice(k, k+n, k, k+n).(*mat.Dense).Copy(kf.factor)
+
+	post := lowerTriangularize(pre)
+
+	innovationFactor := triangularPart(post, k)
+	scaledGain := post.Slice(k, k+n, 0, k)
+
+	preFitResidual := mat.NewVecDense(k, nil)
+	preFitResidual.SubVec(z, m.Observe(kf.state))
+
+	// Solve S_e^1/2 w = z - h(x), so that the state correction is K'w.
+	w := mat.NewVecDense(k, nil)
+	err = w.SolveVec(innovationFactor, preFitResidual)
+	if err != nil {
+		return fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	correction := mat.NewVecDense(n, nil)
+	correction.MulVec(scaledGain, w)
+
+	kf.state.AddVec(kf.state, correction)
+	kf.factor = triangularPart(post.Slice(k, k+n, k, k+n), n)
+	kf.t = t
+
+	return nil
+}
+
+// lowerTriangularize returns a lower trapezoidal matrix L such that LL^T = AA^T.
+// This is computed from the QR decomposition of A^T, since if A^T = QR then AA^T = R^TR.
+func lowerTriangularize(a mat.Matrix) *mat.Dense {
+	var qr mat.QR
+	qr.Factorize(mat.DenseCopyOf(a.T()))
+
+	r, _ := a.Dims()
+	R := qr.RTo(nil)
+
+	result := mat.NewDense(r, r, nil)
+	result.Copy(R.Slice(0, r, 0, r).T())
+
+	return result
+}
+
+// triangularPart copies the lower triangle of the leading n×n block of a.
+func triangularPart(a mat.Matrix, n int) *mat.TriDense {
+	result := mat.NewTriDense(n, mat.Lower, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			result.SetTri(i, j, a.At(i, j))
+		}
+	}
+	return result
+}
+
+// lowerFactor returns a lower triangular factor L of the positive semi-definite
+// matrix a, such that LL^T = a.
+func lowerFactor(a mat.Matrix) (*mat.TriDense, error) {
+	root, err := squareRoot(a)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := a.Dims()
+	return triangularPart(lowerTriangularize(root), n), nil
+}
+
+// covarianceFactor returns the lower triangular factor of a covariance, which must
+// be a positive semi-definite matrix of size dims×dims.
+func covarianceFactor(covariance mat.Matrix, dims int) (*mat.TriDense, error) {
+	if covariance == nil {
+		return nil, fmt.Errorf("missing covariance")
+	}
+
+	if r, c := covariance.Dims(); r != dims || c != dims {
+		return nil, fmt.Errorf("covariance has incorrect size: %dx%d (expected %dx%d)", r, c, dims, dims)
+	}
+
+	return lowerFactor(covariance)
+}
+
+// squareRoot returns a matrix F such that FF^T = a, for a positive semi-definite matrix a.
+// The Cholesky factorization is used where possible. Semi-definite matrices,
+// such as process noise with deterministic components, fall back to an
+// eigendecomposition.
+func squareRoot(a mat.Matrix) (*mat.Dense, error) {
+	sym := symmetrize(a)
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(sym); ok {
+		return mat.DenseCopyOf(chol.LTo(nil)), nil
+	}
+
+	var eigen mat.EigenSym
+	if ok := eigen.Factorize(sym, true); !ok {
+		return nil, fmt.Errorf("eigendecomposition failed")
+	}
+
+	values := eigen.Values(nil)
+	vectors := eigen.VectorsTo(nil)
+
+	n := len(values)
+	scale := 0.0
+	for _, v := range values {
+		scale = math.Max(scale, math.Abs(v))
+	}
+
+	for j, v := range values {
+		if v < -1e-12*scale {
+			return nil, fmt.Errorf("matrix is not positive semi-definite")
+		}
+
+		s := math.Sqrt(math.Max(v, 0))
+		for i := 0; i < n; i++ {
+			vectors.Set(i, j, vectors.At(i, j)*s)
+		}
+	}
+
+	return vectors, nil
+}
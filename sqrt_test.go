@@ -0,0 +1,92 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+func newTestSquareRootKalmanFilter(t *testing.T, model models.LinearModel) *SquareRootKalmanFilter {
+	t.Helper()
+
+	filter, err := NewSquareRootKalmanFilter(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filter
+}
+
+func TestSquareRootKalmanFilterMatchesKalmanFilter(t *testing.T) {
+	testModels := map[string]*models.ConstantVelocityModel{
+		"default": newTestModel(),
+		"zero initial variance": models.NewConstantVelocityModel(
+			time.Time{},
+			mat.NewVecDense(1, nil),
+			models.ConstantVelocityModelConfig{ProcessVariance: 0.1},
+		),
+	}
+
+	for name, model := range testModels {
+		expected := NewKalmanFilter(model)
+		actual := newTestSquareRootKalmanFilter(t, model)
+
+		for _, m := range newTestMeasurements(model, 10) {
+			if err := expected.Update(m.Time, &m.Measurement); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			if err := actual.Update(m.Time, &m.Measurement); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			assertVecNear(t, expected.State(), actual.State(), 1e-9)
+			assertMatNear(t, expected.Covariance(), actual.Covariance(), 1e-9)
+		}
+	}
+}
+
+func TestSquareRootKalmanFilterWithInvalidCovarianceIsAnError(t *testing.T) {
+	indefinite := mat.NewDense(2, 2, []float64{1, 2, 2, 1})
+
+	model := models.NewContinuousLinearModel(
+		models.State{State: mat.NewVecDense(2, nil), Covariance: indefinite},
+		mat.NewDense(2, 2, nil),
+		mat.NewDense(2, 2, nil),
+	)
+
+	if _, err := NewSquareRootKalmanFilter(model); err == nil {
+		t.Errorf("expected an error for an indefinite initial covariance")
+	}
+
+	filter := newTestSquareRootKalmanFilter(t, newTestModel())
+	covariances := map[string]mat.Matrix{
+		"indefinite": indefinite,
+		"wrong size": mat.NewDense(1, 1, []float64{1}),
+		"missing":    nil,
+	}
+
+	for name, covariance := range covariances {
+		if err := filter.SetCovariance(covariance); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSquareRootKalmanFilterWithMismatchedMeasurementIsAnError(t *testing.T) {
+	model := newTestModel()
+	filter := newTestSquareRootKalmanFilter(t, model)
+
+	m := &models.Measurement{
+		Value:            mat.NewVecDense(1, []float64{1}),
+		Covariance:       mat.NewDense(1, 1, []float64{0.1}),
+		ObservationModel: mat.NewDense(1, 3, []float64{1, 0, 0}),
+	}
+
+	err := filter.Update(model.InitialState().Time, m)
+	if _, ok := err.(*DimensionMismatchError); !ok {
+		t.Errorf("expected a DimensionMismatchError, got %v", err)
+	}
+}
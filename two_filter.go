@@ -0,0 +1,147 @@
+package kalman
+
+import (
+	"fmt"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// smoothTwoFilter combines the forwards estimates x_{k|k}, P_{k|k} with the information
+// Y^b_k, y^b_k about x_k given the measurements after step k, computed by a backwards
+// information filter. The smoothed estimate is then
+// x_{k|n} = (I + P_{k|k} Y^b_k)^-1 (x_{k|k} + P_{k|k} y^b_k) and P_{k|n} = (I + P_{k|k} Y^b_k)^-1 P_{k|k}.
+func smoothTwoFilter(ss []kalmanStateChange) (*backwardsPass, error) {
+	n := len(ss)
+	dims := ss[0].aPrioriState.Len()
+
+	result := &backwardsPass{
+		states: make([]models.State, n),
+	}
+
+	// The information about x_k given the measurements after step k.
+	Y := mat.NewDense(dims, dims, nil)
+	y := mat.NewVecDense(dims, nil)
+
+	for k := n - 1; k >= 0; k-- {
+		x, P, err := combineInformation(ss[k].APoseterioriState, ss[k].aPosterioriCovariance, Y, y)
+		if err != nil {
+			return nil, &SingularCovarianceError{Index: k, Err: err}
+		}
+
+		result.states[k] = models.State{
+			Time:       ss[k].time,
+			State:      x,
+			Covariance: P,
+		}
+
+		if k == 0 {
+			break
+		}
+
+		if m := ss[k].measurement; m != nil {
+			err := addMeasurementInformation(Y, y, m)
+			if err != nil {
+				return nil, fmt.Errorf("measurement at index %d: %s", k, err)
+			}
+		}
+
+		err = predictInformationBackwards(Y, y, ss[k].modelTransition, ss[k].processNoise)
+		if err != nil {
+			return nil, fmt.Errorf("backwards prediction at index %d: %s", k, err)
+		}
+	}
+
+	return result, nil
+}
+
+// combineInformation fuses the estimate x, P with the information Y, y about the same state.
+func combineInformation(x mat.Vector, P mat.Matrix, Y mat.Matrix, y mat.Vector) (*mat.VecDense, *mat.Dense, error) {
+	dims := x.Len()
+
+	// A = I + PY
+	A := mat.NewDense(dims, dims, nil)
+	A.Mul(P, Y)
+	A.Add(eye(dims), A)
+
+	combined := mat.NewVecDense(dims, nil)
+	combined.MulVec(P, y)
+	combined.AddVec(x, combined)
+
+	state := mat.NewVecDense(dims, nil)
+	err := state.SolveVec(A, combined)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	covariance := mat.NewDense(dims, dims, nil)
+	err = covariance.Solve(A, P)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return state, covariance, nil
+}
+
+// addMeasurementInformation adds the information H^T R^-1 H, H^T R^-1 z
+// of the linear measurement to Y and y.
+func addMeasurementInformation(Y *mat.Dense, y *mat.VecDense, m *models.Measurement) error {
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(m.Covariance)); !ok {
+		return fmt.Errorf("covariance is not positive definite")
+	}
+
+	H := m.ObservationModel
+	r, dims := H.Dims()
+
+	RInvH := mat.NewDense(r, dims, nil)
+	err := chol.SolveTo(RInvH, H)
+	if err != nil {
+		return err
+	}
+
+	RInvz := mat.NewVecDense(r, nil)
+	err = chol.SolveVecTo(RInvz, m.Value)
+	if err != nil {
+		return err
+	}
+
+	information := mat.NewDense(dims, dims, nil)
+	information.Mul(H.T(), RInvH)
+	Y.Add(Y, information)
+
+	informationVector := mat.NewVecDense(dims, nil)
+	informationVector.MulVec(H.T(), RInvz)
+	y.AddVec(y, informationVector)
+
+	return nil
+}
+
+// predictInformationBackwards replaces the information Y, y about x_k with that about x_{k-1},
+// for the transition x_k = F x_{k-1} + w with process noise Q:
+// Y' = F^T (I + YQ)^-1 Y F and y' = F^T (I + YQ)^-1 y.
+func predictInformationBackwards(Y *mat.Dense, y *mat.VecDense, F, Q mat.Matrix) error {
+	dims := y.Len()
+
+	// A = I + YQ
+	A := mat.NewDense(dims, dims, nil)
+	A.Mul(Y, Q)
+	A.Add(eye(dims), A)
+
+	AInvY := mat.NewDense(dims, dims, nil)
+	err := AInvY.Solve(A, Y)
+	if err != nil {
+		return err
+	}
+
+	AInvy := mat.NewVecDense(dims, nil)
+	err = AInvy.SolveVec(A, y)
+	if err != nil {
+		return err
+	}
+
+	Y.Product(F.T(), AInvY, F)
+	y.MulVec(F.T(), AInvy)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package kalman
+
+import (
+	"testing"
+)
+
+func TestTwoFilterMatchesRauchTungStriebel(t *testing.T) {
+	model := newTestModel()
+	ms := newNoisyTestMeasurements(model, 50)
+
+	expected := NewKalmanSmoother(model)
+	actual := NewKalmanSmoother(model)
+	actual.SetSmoothingMethod(TwoFilter)
+
+	expectedStates, err := expected.Smooth(ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualStates, err := actual.Smooth(ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatesNear(t, expectedStates, actualStates, 1e-9)
+
+	times := newTestQueryTimes(ms)
+
+	expectedStates, err = expected.SmoothAt(times, ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualStates, err = actual.SmoothAt(times, ms...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatesNear(t, expectedStates, actualStates, 1e-9)
+}
@@ -0,0 +1,302 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// SigmaPointWeights selects the scheme used to generate sigma points and their weights.
+type SigmaPointWeights int
+
+const (
+	// MerweWeights uses the scaled sigma points of van der Merwe, parametrized by
+	// Alpha, Beta and Kappa.
+	MerweWeights SigmaPointWeights = iota
+	// JulierWeights uses the original sigma points of Julier and Uhlmann,
+	// parametrized by Kappa only.
+	JulierWeights
+)
+
+// UnscentedKalmanFilterConfig holds the parameters controlling the spread and
+// weighting of the sigma points.
+// The spread n + lambda must be positive, where n is the dimension of the state,
+// otherwise Predict and Update return an error. For JulierWeights, lambda is Kappa.
+type UnscentedKalmanFilterConfig struct {
+	// Alpha scales the spread of the sigma points for MerweWeights.
+	// If zero, the Alpha of DefaultUnscentedKalmanFilterConfig is used.
+	Alpha   float64
+	Beta    float64
+	Kappa   float64
+	Weights SigmaPointWeights
+}
+
+// DefaultUnscentedKalmanFilterConfig returns commonly used parameters for
+// the scaled unscented transform.
+func DefaultUnscentedKalmanFilterConfig() UnscentedKalmanFilterConfig {
+	return UnscentedKalmanFilterConfig{
+		Alpha:   1e-3,
+		Beta:    2.0,
+		Kappa:   0.0,
+		Weights: MerweWeights,
+	}
+}
+
+// UnscentedKalmanFilter is responsible for prediction and filtering of a given model
+// using the unscented transform. Rather than linearizing the model, a set of sigma points
+// is propagated through the dynamics and through the observation function of each measurement,
+// so that no Jacobians are required.
+type UnscentedKalmanFilter struct {
+	model models.PropagationModel
+	cfg   UnscentedKalmanFilterConfig
+
+	dims       int
+	t          time.Time
+	state      *mat.VecDense
+	covariance *mat.Dense
+
+	// Spread of the sigma points about the mean, along with the weights
+	// for recovering the mean and covariance.
+	scale             float64
+	meanWeights       []float64
+	covarianceWeights []float64
+}
+
+// NewUnscentedKalmanFilter returns a new UnscentedKalmanFilter for the given model.
+// Linear models may be used by wrapping them with models.AsNonlinear.
+func NewUnscentedKalmanFilter(model models.PropagationModel, cfg UnscentedKalmanFilterConfig) *UnscentedKalmanFilter {
+	initial := model.InitialState()
+	dims := initial.State.Len()
+
+	kf := &UnscentedKalmanFilter{
+		model:      model,
+		cfg:        cfg,
+		dims:       dims,
+		t:          initial.Time,
+		state:      mat.VecDenseCopyOf(initial.State),
+		covariance: mat.DenseCopyOf(initial.Covariance),
+	}
+	kf.computeWeights()
+
+	return kf
+}
+
+// State returns the current hidden state of the UnscentedKalmanFilter.
+func (kf *UnscentedKalmanFilter) State() mat.Vector {
+	return kf.state
+}
+
+// Covariance returns the current covariance of the model.
+func (kf *UnscentedKalmanFilter) Covariance() mat.Matrix {
+	return kf.covariance
+}
+
+// SetCovariance resets the covariance of the filter to the given value.
+func (kf *UnscentedKalmanFilter) SetCovariance(covariance mat.Matrix) {
+	kf.covariance = mat.DenseCopyOf(covariance)
+}
+
+// SetState resets the state of the filter to the given value.
+func (kf *UnscentedKalmanFilter) SetState(state mat.Vector) {
+	kf.state = mat.VecDenseCopyOf(state)
+}
+
+// Time returns the time for which the current hidden state is an estimate.
+// The time is monotone increasing.
+func (kf *UnscentedKalmanFilter) Time() time.Time {
+	return kf.t
+}
+
+// Predict advances the filter from the internal current time to the given time
+// by propagating sigma points through the model.
+// Each time can be no earlier than the current time of the filter.
+func (kf *UnscentedKalmanFilter) Predict(t time.Time) error {
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.Equal(kf.t) {
+		return nil
+	}
+
+	dt := t.Sub(kf.t)
+
+	sigmaPoints, err := kf.sigmaPoints()
+	if err != nil {
+		return err
+	}
+
+	propagated := make([]mat.Vector, len(sigmaPoints))
+	for i, p := range sigmaPoints {
+		propagated[i] = kf.model.Propagate(p, dt)
+	}
+
+	state := kf.weightedMean(propagated)
+	covariance := kf.weightedCovariance(propagated, state, propagated, state)
+	covariance.Add(covariance, kf.model.CovarianceTransition(dt))
+
+	kf.state = state
+	kf.covariance = covariance
+	kf.t = t
+
+	return nil
+}
+
+// Update is used to take a new measurement from a sensor and fuse it to the model.
+// The expected value of the measurement is computed by passing sigma points through
+// the observation function of the measurement, so nonlinear measurements do not
+// require an ObservationJacobian.
+// The time field must be no earlier than the current time of the filter.
+func (kf *UnscentedKalmanFilter) Update(t time.Time, m *models.Measurement) error {
+	if t.Before(kf.t) {
+		return fmt.Errorf("can't predict past: %s", t)
+	}
+
+	if t.After(kf.t) {
+		err := kf.Predict(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := checkMeasurement(m, kf.state)
+	if err != nil {
+		return err
+	}
+
+	sigmaPoints, err := kf.sigmaPoints()
+	if err != nil {
+		return err
+	}
+
+	observed := make([]mat.Vector, len(sigmaPoints))
+	for i, p := range sigmaPoints {
+		observed[i] = m.Observe(p)
+	}
+
+	z := m.Value
+	expected := kf.weightedMean(observed)
+
+	preFitResidual := mat.NewVecDense(z.Len(), nil)
+	preFitResidual.SubVec(z, expected)
+
+	preFitResidualCov := kf.weightedCovariance(observed, expected, observed, expected)
+	preFitResidualCov.Add(preFitResidualCov, m.Covariance)
+
+	crossCov := kf.weightedCovariance(sigmaPoints, kf.state, observed, expected)
+
+	// K = Pxz S^-1, computed as the solution of S^T K^T = Pxz^T.
+	gainT := mat.NewDense(z.Len(), kf.dims, nil)
+	err = gainT.Solve(preFitResidualCov.T(), crossCov.T())
+	if err != nil {
+		return fmt.Errorf("failed to compute gain: %s", err)
+	}
+	gain := gainT.T()
+
+	newState := mat.NewVecDense(kf.dims, nil)
+	newState.MulVec(gain, preFitResidual)
+	newState.AddVec(kf.state, newState)
+
+	newCovariance := mat.NewDense(kf.dims, kf.dims, nil)
+	newCovariance.Product(gain, preFitResidualCov, gain.T())
+	newCovariance.Sub(kf.covariance, newCovariance)
+
+	kf.state = newState
+	kf.covariance = newCovariance
+	kf.t = t
+
+	return nil
+}
+
+// computeWeights computes the sigma point spread and weights for the configured scheme.
+func (kf *UnscentedKalmanFilter) computeWeights() {
+	n := float64(kf.dims)
+	count := 2*kf.dims + 1
+
+	kf.meanWeights = make([]float64, count)
+	kf.covarianceWeights = make([]float64, count)
+
+	switch kf.cfg.Weights {
+	case JulierWeights:
+		kf.scale = n + kf.cfg.Kappa
+		kf.meanWeights[0] = kf.cfg.Kappa / kf.scale
+		kf.covarianceWeights[0] = kf.meanWeights[0]
+	default:
+		alpha := kf.cfg.Alpha
+		if alpha == 0 {
+			alpha = DefaultUnscentedKalmanFilterConfig().Alpha
+		}
+
+		alpha2 := alpha * alpha
+		lambda := alpha2*(n+kf.cfg.Kappa) - n
+		kf.scale = n + lambda
+		kf.meanWeights[0] = lambda / kf.scale
+		kf.covarianceWeights[0] = kf.meanWeights[0] + (1 - alpha2 + kf.cfg.Beta)
+	}
+
+	for i := 1; i < count; i++ {
+		kf.meanWeights[i] = 1 / (2 * kf.scale)
+		kf.covarianceWeights[i] = kf.meanWeights[i]
+	}
+}
+
+// sigmaPoints returns the 2n+1 sigma points for the current state and covariance.
+func (kf *UnscentedKalmanFilter) sigmaPoints() ([]mat.Vector, error) {
+	if !(kf.scale > 0) {
+		return nil, fmt.Errorf("sigma points must have a positive spread, n + lambda is %g", kf.scale)
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(symmetrize(kf.covariance)); !ok {
+		return nil, fmt.Errorf("covariance is not positive definite")
+	}
+
+	L := mat.DenseCopyOf(chol.LTo(nil))
+	L.Scale(math.Sqrt(kf.scale), L)
+
+	result := make([]mat.Vector, 2*kf.dims+1)
+	result[0] = mat.VecDenseCopyOf(kf.state)
+
+	for i := 0; i < kf.dims; i++ {
+		plus := mat.NewVecDense(kf.dims, nil)
+		plus.AddVec(kf.state, L.ColView(i))
+		minus := mat.NewVecDense(kf.dims, nil)
+		minus.SubVec(kf.state, L.ColView(i))
+
+		result[1+i] = plus
+		result[1+kf.dims+i] = minus
+	}
+
+	return result, nil
+}
+
+// weightedMean computes the weighted mean of the given transformed sigma points.
+func (kf *UnscentedKalmanFilter) weightedMean(points []mat.Vector) *mat.VecDense {
+	result := mat.NewVecDense(points[0].Len(), nil)
+	for i, p := range points {
+		result.AddScaledVec(result, kf.meanWeights[i], p)
+	}
+
+	return result
+}
+
+// weightedCovariance computes the weighted cross covariance of two sets of
+// transformed sigma points about the given means.
+func (kf *UnscentedKalmanFilter) weightedCovariance(a []mat.Vector, aMean mat.Vector, b []mat.Vector, bMean mat.Vector) *mat.Dense {
+	result := mat.NewDense(aMean.Len(), bMean.Len(), nil)
+	da := mat.NewVecDense(aMean.Len(), nil)
+	db := mat.NewVecDense(bMean.Len(), nil)
+	outer := mat.NewDense(aMean.Len(), bMean.Len(), nil)
+
+	for i := range a {
+		da.SubVec(a[i], aMean)
+		db.SubVec(b[i], bMean)
+		outer.Outer(kf.covarianceWeights[i], da, db)
+		result.Add(result, outer)
+	}
+
+	return result
+}
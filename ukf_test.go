@@ -0,0 +1,76 @@
+package kalman
+
+import (
+	"testing"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestUnscentedKalmanFilterMatchesKalmanFilter(t *testing.T) {
+	model := newTestModel()
+	ms := newTestMeasurements(model, 5)
+
+	configs := map[string]UnscentedKalmanFilterConfig{
+		"default":    DefaultUnscentedKalmanFilterConfig(),
+		"zero value": {},
+		"julier":     {Weights: JulierWeights, Kappa: 1},
+	}
+
+	for name, cfg := range configs {
+		expected := NewKalmanFilter(model)
+		actual := NewUnscentedKalmanFilter(models.AsNonlinear(model), cfg)
+
+		for _, m := range ms {
+			if err := expected.Update(m.Time, &m.Measurement); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := actual.Update(m.Time, &m.Measurement); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+
+		// The unscented transform is exact for linear models.
+		assertVecNear(t, expected.State(), actual.State(), 1e-6)
+		assertMatNear(t, expected.Covariance(), actual.Covariance(), 1e-6)
+	}
+}
+
+func TestUnscentedKalmanFilterWithInvalidSpreadIsAnError(t *testing.T) {
+	model := newTestModel()
+	m := newTestMeasurements(model, 1)[0]
+
+	configs := map[string]UnscentedKalmanFilterConfig{
+		"merwe":  {Alpha: 1, Kappa: -2},
+		"julier": {Weights: JulierWeights, Kappa: -3},
+	}
+
+	for name, cfg := range configs {
+		filter := NewUnscentedKalmanFilter(models.AsNonlinear(model), cfg)
+
+		if err := filter.Predict(m.Time); err == nil {
+			t.Errorf("%s: expected an error predicting", name)
+		}
+
+		if err := filter.Update(m.Time, &m.Measurement); err == nil {
+			t.Errorf("%s: expected an error updating", name)
+		}
+	}
+}
+
+func TestUnscentedKalmanFilterWithMismatchedMeasurementIsAnError(t *testing.T) {
+	model := newTestModel()
+	filter := NewUnscentedKalmanFilter(models.AsNonlinear(model), DefaultUnscentedKalmanFilterConfig())
+
+	m := &models.Measurement{
+		Value:            mat.NewVecDense(1, []float64{1}),
+		Covariance:       mat.NewDense(2, 2, nil),
+		ObservationModel: mat.NewDense(1, 2, []float64{1, 0}),
+	}
+
+	err := filter.Update(model.InitialState().Time, m)
+	if _, ok := err.(*DimensionMismatchError); !ok {
+		t.Errorf("expected a DimensionMismatchError, got %v", err)
+	}
+}
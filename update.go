@@ -0,0 +1,366 @@
+package kalman
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// CovarianceUpdateForm selects the formula used to compute the a posteriori covariance.
+type CovarianceUpdateForm int
+
+const (
+	// SimpleForm computes P = (I - KH)P. This is cheap, but rounding errors can
+	// cause the covariance to lose symmetry and positive-definiteness over long runs.
+	SimpleForm CovarianceUpdateForm = iota
+	// JosephForm computes P = (I - KH)P(I - KH)^T + KRK^T, which is symmetric and
+	// positive semi-definite by construction, at the cost of a few extra matrix products.
+	JosephForm
+)
+
+// UpdateConfig controls how measurements are fused.
+// The zero value reproduces the classic textbook update.
+type UpdateConfig struct {
+	// CovarianceForm selects the formula used to update the covariance.
+	CovarianceForm CovarianceUpdateForm
+
+	// CholeskySolve computes the Kalman gain by solving against a Cholesky factorization
+	// of the innovation covariance, rather than by forming its explicit inverse.
+	CholeskySolve bool
+
+	// Symmetrize replaces the updated covariance with its symmetric part, (P + P^T) / 2.
+	Symmetrize bool
+
+	// Gate, if set, is used to reject or down-weight outlying measurements.
+	Gate *Gate
+
+	// Robust, if set, reweights the covariance of each measurement according to a robust loss.
+	// This is applied after the Gate.
+	Robust *RobustUpdate
+}
+
+// UpdateResult holds the intermediate quantities computed when fusing a measurement.
+// These are useful for monitoring the consistency of a filter.
+type UpdateResult struct {
+	// PreFitResidual is the innovation z - h(x) of the measurement against the a priori state.
+	PreFitResidual mat.Vector
+	// PreFitResidualCovariance is the innovation covariance S = HPH^T + R.
+	PreFitResidualCovariance mat.Matrix
+	// Gain is the Kalman gain K = PH^T S^-1.
+	Gain mat.Matrix
+	// PostFitResidual is the residual z - h(x) of the measurement against the a posteriori state.
+	PostFitResidual mat.Vector
+	// NormalizedInnovationSquared is the squared Mahalanobis distance of the innovation,
+	// y^T S^-1 y. For a consistent filter it is chi-square distributed with degrees of freedom
+	// equal to the dimension of the measurement.
+	NormalizedInnovationSquared float64
+
+	// LogLikelihood is the log of the Gaussian density of the innovation, log N(y; 0, S).
+	// This is the contribution of the measurement to the log-likelihood of the model.
+	LogLikelihood float64
+
+	// Rejected is true if the measurement was rejected by a gate, in which case
+	// the state and covariance were not changed.
+	Rejected bool
+	// CovarianceScale is the factor by which the covariance of the measurement was inflated
+	// before it was fused. This is 1 unless the measurement was down-weighted by a gate
+	// or by a robust update.
+	CovarianceScale float64
+}
+
+// posterior holds the outcome of fusing a measurement into a state.
+type posterior struct {
+	state      *mat.VecDense
+	covariance *mat.Dense
+	result     *UpdateResult
+}
+
+// measurementUpdate fuses the measurement into the given state and covariance,
+// returning the new a posteriori state and covariance along with the intermediate results.
+func measurementUpdate(state *mat.VecDense, covariance *mat.Dense, m *models.Measurement, cfg UpdateConfig) (*posterior, error) {
+	err := checkJacobian(m)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkMeasurement(m, state)
+	if err != nil {
+		return nil, err
+	}
+
+	z := m.Value
+	H := m.Jacobian(state)
+	P := covariance
+
+	preFitResidual := mat.NewVecDense(z.Len(), nil)
+	preFitResidual.SubVec(z, m.Observe(state))
+
+	R := m.Covariance
+	scale := 1.0
+
+	preFitResidualCov, nis, err := innovation(P, H, R, preFitResidual)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Gate != nil {
+		err := cfg.Gate.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		threshold := cfg.Gate.Threshold(z.Len())
+
+		if nis > threshold {
+			switch cfg.Gate.Action {
+			case DownWeightOutliers:
+				scale = nis / threshold
+				scaled := mat.NewDense(z.Len(), z.Len(), nil)
+				scaled.Scale(scale, R)
+				R = scaled
+
+				preFitResidualCov, nis, err = innovation(P, H, R, preFitResidual)
+				if err != nil {
+					return nil, err
+				}
+			default:
+				return rejected(state, covariance, preFitResidual, preFitResidualCov, nis), nil
+			}
+		}
+	}
+
+	if cfg.Robust != nil {
+		weight, err := robustWeight(state, P, H, R, m, preFitResidual, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		scale /= weight
+		scaled := mat.NewDense(z.Len(), z.Len(), nil)
+		scaled.Scale(1/weight, R)
+		R = scaled
+
+		preFitResidualCov, nis, err = innovation(P, H, R, preFitResidual)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gain, err := kalmanGain(P, H, preFitResidualCov, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	newState, newCovariance := applyGain(state, P, H, R, gain, preFitResidual, cfg)
+
+	postFitResidual := mat.NewVecDense(z.Len(), nil)
+	postFitResidual.SubVec(z, m.Observe(newState))
+
+	return &posterior{
+		state:      newState,
+		covariance: newCovariance,
+		result: &UpdateResult{
+			PreFitResidual:              preFitResidual,
+			PreFitResidualCovariance:    preFitResidualCov,
+			Gain:                        gain,
+			PostFitResidual:             postFitResidual,
+			NormalizedInnovationSquared: nis,
+			LogLikelihood:               logLikelihood(preFitResidualCov, nis),
+			CovarianceScale:             scale,
+		},
+	}, nil
+}
+
+// checkJacobian returns an error if the measurement is nonlinear, but has no
+// ObservationJacobian with which to linearize it.
+func checkJacobian(m *models.Measurement) error {
+	if m.IsNonlinear() && m.ObservationJacobian == nil {
+		return fmt.Errorf("nonlinear measurement has no observation jacobian")
+	}
+
+	return nil
+}
+
+// checkMeasurement returns a DimensionMismatchError if the value, covariance or observation
+// of a measurement are missing, or are inconsistent with each other or with the state x.
+// Nonlinear measurements are checked by evaluating their observation function
+// and Jacobian, if any, at x.
+func checkMeasurement(m *models.Measurement, x mat.Vector) error {
+	dims := x.Len()
+
+	if m.Value == nil {
+		n := 0
+		if m.Covariance != nil {
+			n, _ = m.Covariance.Dims()
+		}
+
+		return &DimensionMismatchError{Index: -1, Name: "value", ExpectedRows: n, ExpectedCols: 1}
+	}
+
+	n := m.Value.Len()
+
+	err := checkSize("covariance", m.Covariance, n, n)
+	if err != nil {
+		return err
+	}
+
+	if !m.IsNonlinear() {
+		return checkSize("observation model", m.ObservationModel, n, dims)
+	}
+
+	if h := m.ObservationFunction(x); h == nil || h.Len() != n {
+		rows := 0
+		if h != nil {
+			rows = h.Len()
+		}
+
+		return &DimensionMismatchError{
+			Index: -1, Name: "observation",
+			Rows: rows, Cols: 1, ExpectedRows: n, ExpectedCols: 1,
+		}
+	}
+
+	if m.ObservationJacobian != nil {
+		return checkSize("observation jacobian", m.ObservationJacobian(x), n, dims)
+	}
+
+	return nil
+}
+
+// checkSize returns a DimensionMismatchError if the given matrix is missing, or is not
+// of the expected size.
+func checkSize(name string, a mat.Matrix, rows, cols int) error {
+	r, c := 0, 0
+	if a != nil {
+		r, c = a.Dims()
+	}
+
+	if a == nil || r != rows || c != cols {
+		return &DimensionMismatchError{
+			Index: -1, Name: name,
+			Rows: r, Cols: c, ExpectedRows: rows, ExpectedCols: cols,
+		}
+	}
+
+	return nil
+}
+
+// rejected returns the outcome of a measurement rejected by a gate,
+// which leaves the state and covariance unchanged.
+func rejected(state *mat.VecDense, covariance *mat.Dense, preFitResidual *mat.VecDense, preFitResidualCov *mat.Dense, nis float64) *posterior {
+	dims := state.Len()
+	measurementDims := preFitResidual.Len()
+
+	return &posterior{
+		state:      state,
+		covariance: covariance,
+		result: &UpdateResult{
+			PreFitResidual:              preFitResidual,
+			PreFitResidualCovariance:    preFitResidualCov,
+			Gain:                        mat.NewDense(dims, measurementDims, nil),
+			PostFitResidual:             preFitResidual,
+			NormalizedInnovationSquared: nis,
+			LogLikelihood:               logLikelihood(preFitResidualCov, nis),
+			Rejected:                    true,
+			CovarianceScale:             1.0,
+		},
+	}
+}
+
+// innovation computes the innovation covariance S = HPH^T + R, along with the
+// normalized innovation squared of the given residual.
+func innovation(P, H, R mat.Matrix, preFitResidual mat.Vector) (*mat.Dense, float64, error) {
+	n := preFitResidual.Len()
+
+	preFitResidualCov := mat.NewDense(n, n, nil)
+	preFitResidualCov.Product(H, P, H.T())
+	preFitResidualCov.Add(preFitResidualCov, R)
+
+	normalizedInnovation := mat.NewVecDense(n, nil)
+	err := normalizedInnovation.SolveVec(preFitResidualCov, preFitResidual)
+	if err != nil {
+		return nil, 0, fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	return preFitResidualCov, mat.Dot(preFitResidual, normalizedInnovation), nil
+}
+
+// logLikelihood computes log N(y; 0, S) from the normalized innovation squared of y.
+func logLikelihood(S mat.Matrix, nis float64) float64 {
+	n, _ := S.Dims()
+	logDet, _ := mat.LogDet(S)
+	return -0.5 * (float64(n)*math.Log(2*math.Pi) + logDet + nis)
+}
+
+// applyGain computes the a posteriori state and covariance for the given Kalman gain.
+func applyGain(state *mat.VecDense, P, H, R mat.Matrix, gain *mat.Dense, preFitResidual mat.Vector, cfg UpdateConfig) (*mat.VecDense, *mat.Dense) {
+	dims := state.Len()
+
+	newState := mat.NewVecDense(dims, nil)
+	newState.MulVec(gain, preFitResidual)
+	newState.AddVec(state, newState)
+
+	// A = I - KH
+	A := mat.NewDense(dims, dims, nil)
+	A.Mul(gain, H)
+	A.Sub(eye(dims), A)
+
+	newCovariance := mat.NewDense(dims, dims, nil)
+
+	switch cfg.CovarianceForm {
+	case JosephForm:
+		newCovariance.Product(A, P, A.T())
+
+		noise := mat.NewDense(dims, dims, nil)
+		noise.Product(gain, R, gain.T())
+		newCovariance.Add(newCovariance, noise)
+	default:
+		newCovariance.Mul(A, P)
+	}
+
+	if cfg.Symmetrize {
+		newCovariance = mat.DenseCopyOf(symmetrize(newCovariance))
+	}
+
+	return newState, newCovariance
+}
+
+// kalmanGain computes K = PH^T S^-1 for the innovation covariance S.
+func kalmanGain(P, H, S mat.Matrix, cfg UpdateConfig) (*mat.Dense, error) {
+	dims, _ := P.Dims()
+	measurementDims, _ := S.Dims()
+
+	gain := mat.NewDense(dims, measurementDims, nil)
+
+	if cfg.CholeskySolve {
+		var chol mat.Cholesky
+		if ok := chol.Factorize(symmetrize(S)); !ok {
+			return nil, fmt.Errorf("innovation covariance is not positive definite")
+		}
+
+		// Since P and S are symmetric, K^T = S^-1 H P.
+		HP := mat.NewDense(measurementDims, dims, nil)
+		HP.Mul(H, P)
+
+		gainT := mat.NewDense(measurementDims, dims, nil)
+		err := chol.SolveTo(gainT, HP)
+		if err != nil {
+			return nil, fmt.Errorf("innovation covariance is singular: %s", err)
+		}
+
+		gain.Copy(gainT.T())
+		return gain, nil
+	}
+
+	SInv := mat.NewDense(measurementDims, measurementDims, nil)
+	err := SInv.Inverse(S)
+	if err != nil {
+		return nil, fmt.Errorf("innovation covariance is singular: %s", err)
+	}
+
+	gain.Product(P, H.T(), SInv)
+
+	return gain, nil
+}
@@ -0,0 +1,48 @@
+package kalman
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosshemsley/kalman/models"
+	"gonum.org/v1/gonum/mat"
+)
+
+// newMeasurementWithoutJacobian returns a nonlinear measurement of the position,
+// which can't be linearized.
+func newMeasurementWithoutJacobian() *models.Measurement {
+	return models.NewNonlinearMeasurement(
+		mat.NewVecDense(1, []float64{1}),
+		mat.NewDense(1, 1, []float64{0.1}),
+		func(state mat.Vector) mat.Vector {
+			return mat.NewVecDense(1, []float64{state.AtVec(0)})
+		},
+		nil,
+	)
+}
+
+func TestMissingJacobianIsAnError(t *testing.T) {
+	model := newTestModel()
+	ts := model.InitialState().Time
+	m := newMeasurementWithoutJacobian()
+
+	filters := map[string]interface {
+		Update(time.Time, *models.Measurement) error
+	}{
+		"KalmanFilter":           NewKalmanFilter(model),
+		"ExtendedKalmanFilter":   NewExtendedKalmanFilter(models.AsNonlinear(model)),
+		"SquareRootKalmanFilter": newTestSquareRootKalmanFilter(t, model),
+		"InformationFilter":      newTestInformationFilter(t, model),
+	}
+
+	for name, filter := range filters {
+		if err := filter.Update(ts, m); err == nil {
+			t.Errorf("%s: expected an error for a measurement without a jacobian", name)
+		}
+	}
+
+	_, err := NewKalmanSmoother(model).Smooth(NewMeasurementAtTime(ts, m))
+	if err == nil {
+		t.Errorf("KalmanSmoother: expected an error for a measurement without a jacobian")
+	}
+}